@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanPrefix string
+	cleanYes    bool
+	cleanDryRun bool
+)
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Delete the local branches created by a previous split",
+	Args:  cobra.NoArgs,
+	RunE:  runClean,
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	repo, err := openRepository()
+	if err != nil {
+		return fmt.Errorf("Failed to initialize repository: %w", err)
+	}
+	branches, current, err := splitBranches(repo, cleanPrefix)
+	if err != nil {
+		return fmt.Errorf("Failed to list split branches: %w", err)
+	}
+	if current != "" {
+		infof("Warning: not deleting '%s' because it is checked out.\n", current)
+	}
+	if len(branches) == 0 {
+		infof("No branches with the prefix '%s' to delete.\n", cleanPrefix)
+		return nil
+	}
+
+	infof("Branches with the prefix '%s':\n", cleanPrefix)
+	for _, name := range branches {
+		infof("- %s\n", name)
+	}
+	if cleanDryRun {
+		infof("Dry run: %d branch(es) would be deleted.\n", len(branches))
+		return nil
+	}
+	if !cleanYes {
+		answer, err := promptLine(bufio.NewReader(os.Stdin), fmt.Sprintf("Delete %d branch(es)? [y/N]: ", len(branches)))
+		if err != nil {
+			return fmt.Errorf("Failed to confirm: %w", err)
+		}
+		if answer != "y" && answer != "yes" {
+			infof("Aborted; no branches were deleted.\n")
+			return nil
+		}
+	}
+
+	for _, name := range branches {
+		if err := repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(name)); err != nil {
+			return fmt.Errorf("Failed to delete branch '%s': %w", name, err)
+		}
+		infof("Deleted branch '%s'\n", name)
+	}
+	return nil
+}
+
+// splitBranches returns the local branches named like the split branches of
+// prefix, either the prefix itself or the prefix followed by '_', except the
+// checked-out one, which is returned separately if it matches.
+func splitBranches(repo *git.Repository, prefix string) (branches []string, current string, err error) {
+	var head string
+	if ref, err := repo.Head(); err == nil {
+		head = ref.Name().Short()
+	}
+	refs, err := repo.Branches()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list branches: %v", err)
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		if name != prefix && !strings.HasPrefix(name, prefix+"_") {
+			return nil
+		}
+		if name == head {
+			current = name
+		} else {
+			branches = append(branches, name)
+		}
+		return nil
+	})
+	return branches, current, err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// configFormatFor returns the serialization of the split config at path:
+// --config-format when given, otherwise the one implied by the extension,
+// falling back to YAML.
+func configFormatFor(path string) string {
+	if configFormat != "" {
+		return configFormat
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	}
+	return "yaml"
+}
+
+func validateConfigFormat() error {
+	switch configFormat {
+	case "", "yaml", "json", "toml":
+		return nil
+	case "yml":
+		configFormat = "yaml"
+		return nil
+	}
+	return fmt.Errorf("unknown --config-format value '%s' (expected yaml, json or toml)", configFormat)
+}
+
+func encodeSplitConfig(cfg SplitConfig, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		return append(data, '\n'), nil
+	case "toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to marshal TOML: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+	data, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %v", err)
+	}
+	return data, nil
+}
+
+func decodeSplitConfig(data []byte, format string, cfg *SplitConfig) error {
+	switch format {
+	case "json":
+		return json.Unmarshal(data, cfg)
+	case "toml":
+		return toml.Unmarshal(data, cfg)
+	}
+	return yaml.Unmarshal(data, cfg)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/m0a/git-split-branch/internal/split"
+	"github.com/spf13/cobra"
+)
+
+var diffNullTerminated bool
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Print the files that differ between the base and source branches, like git diff --name-status",
+	Args:  cobra.NoArgs,
+	RunE:  runDiff,
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	// Only the file list is printed; -v still shows how it was computed
+	split.Verbosity = split.LevelQuiet
+	if verbose {
+		split.Verbosity = split.LevelVerbose
+	}
+	prefixes, err := split.CleanPathPrefixes(pathPrefixes)
+	if err != nil {
+		return fmt.Errorf("Invalid arguments: %w", err)
+	}
+	pathPrefixes = prefixes
+	repo, err := openRepository()
+	if err != nil {
+		return fmt.Errorf("Failed to initialize repository: %w", err)
+	}
+	if !cmd.Flags().Changed("base") && !baseFromConfig {
+		if detected, ok := split.DetectDefaultBranch(repo); ok {
+			baseBranch = detected
+		}
+	}
+	commitLogs = split.NewCommitLogs(split.Range{Base: baseBranch, Source: sourceBranch})
+	_, baseTree, err := getBranchCommitAndTree(repo, baseBranch)
+	if err != nil {
+		return fmt.Errorf("Failed to get base branch details: %w", err)
+	}
+	_, sourceTree, err := getBranchCommitAndTree(repo, sourceBranch)
+	if err != nil {
+		return fmt.Errorf("Failed to get source branch details: %w", err)
+	}
+	diff, err := split.DiffFiles(cmd.Context(), baseTree, sourceTree, diffOptions())
+	if err != nil {
+		return fmt.Errorf("Failed to get diff files: %w", err)
+	}
+	return printNameStatus(diff, diffNullTerminated)
+}
+
+// Status letters of git diff --name-status
+var nameStatusLetters = map[string]string{
+	split.ActionAdd:    "A",
+	split.ActionModify: "M",
+	split.ActionDelete: "D",
+	split.ActionRename: "R",
+}
+
+// printNameStatus prints each diff file as its status letter and path,
+// separated by a tab, with both paths for renames. With nullTerminated every
+// field ends with a NUL byte instead, as with git diff --name-status -z.
+func printNameStatus(diff []DiffFile, nullTerminated bool) error {
+	w := bufio.NewWriter(os.Stdout)
+	for _, file := range diff {
+		fields := []string{nameStatusLetters[file.Action]}
+		if file.Action == split.ActionRename {
+			fields = append(fields, file.From)
+		}
+		fields = append(fields, file.Name)
+		if nullTerminated {
+			for _, field := range fields {
+				fmt.Fprintf(w, "%s\x00", field)
+			}
+			continue
+		}
+		for i, field := range fields {
+			if i > 0 {
+				w.WriteString("\t")
+			}
+			w.WriteString(field)
+		}
+		w.WriteString("\n")
+	}
+	return w.Flush()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/m0a/git-split-branch/internal/split"
+)
+
+// Errors returned by run that callers may want to tell apart with errors.Is.
+// They are defined by internal/split, which returns most of them.
+var (
+	ErrBranchNotFound = split.ErrBranchNotFound
+	ErrDirtyWorktree  = split.ErrDirtyWorktree
+	ErrNothingToSplit = split.ErrNothingToSplit
+	ErrMissingFiles   = split.ErrMissingFiles
+	ErrInterrupted    = split.ErrInterrupted
+	ErrInvalidConfig  = split.ErrInvalidConfig
+)
+
+// Exit statuses of the failures scripts may want to react to; any other
+// error exits with status 1
+const (
+	exitBranchNotFound = 2
+	exitDirtyWorktree  = 3
+	exitInvalidConfig  = 4
+	// The branches were created, but some files of the split config could
+	// not be split
+	exitMissingFiles = 5
+)
+
+// Help text listing the exit statuses, shown by --help
+const exitStatusHelp = `Exit status:
+  0  the branches were created (or nothing had to be done)
+  1  any other failure
+  2  the source, base or --from revision does not exist
+  3  the working tree is dirty (see --allow-dirty)
+  4  the split config is invalid
+  5  the branches were created, but some files were skipped (see --ignore-missing)`
+
+// exitCode returns the exit status for an error returned by a command.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrBranchNotFound):
+		return exitBranchNotFound
+	case errors.Is(err, ErrDirtyWorktree):
+		return exitDirtyWorktree
+	case errors.Is(err, ErrInvalidConfig):
+		return exitInvalidConfig
+	case errors.Is(err, ErrMissingFiles):
+		return exitMissingFiles
+	}
+	return 1
+}
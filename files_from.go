@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// readFilesFrom reads the newline separated paths given to --files-from,
+// from stdin when name is "-". Blank lines and duplicates are dropped.
+func readFilesFrom(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open '%s': %v", name, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		file := strings.TrimPrefix(path.Clean(line), "./")
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %v", err)
+	}
+	return files, nil
+}
+
+// terminalInput returns the terminal that interactive programs read from:
+// stdin, or /dev/tty when --files-from - has consumed stdin.
+func terminalInput() (*os.File, error) {
+	if filesFrom != "-" {
+		return os.Stdin, nil
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, fmt.Errorf("stdin is used by --files-from - and no terminal is available: %v", err)
+	}
+	return tty, nil
+}
@@ -0,0 +1,923 @@
+package split
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Result of creating the branch of a split group
+type BranchResult struct {
+	Name    string   `json:"name"`
+	Hash    string   `json:"hash"`
+	Files   []string `json:"files"`
+	Pushed  bool     `json:"pushed"`
+	Skipped bool     `json:"skipped"`
+	// Files of the group that exist in neither the source nor the base tree
+	Missing []string `json:"missing,omitempty"`
+	// Set with --no-commit when the staged files were stashed instead
+	Stashed bool `json:"stashed,omitempty"`
+	// URL of the pull request opened with --open-pr
+	PullRequest string `json:"pullRequest,omitempty"`
+	// Annotated tag created with --as-tags or --also-tag
+	Tag string `json:"tag,omitempty"`
+	// Files of --allow-shared that other branches got as well
+	Shared []string `json:"shared,omitempty"`
+	// Lines changed compared to the commit the branch was created on, with
+	// --stats
+	Stats *BranchStats `json:"stats,omitempty"`
+}
+
+// BranchOptions selects how CreateBranches and SplitByCommits create the
+// branches. The fields mirror the flags of the same names.
+type BranchOptions struct {
+	// Recorded by the trailers and the manifest
+	Range    Range
+	Messages MessageOptions
+	// Hunks of the files split with --split-hunks (see LoadSplitHunks)
+	Hunks            map[string]*FileHunks
+	IncludeDeletions bool
+	Stacked          bool
+	StackCumulative  bool
+	// Permissions of written files; 0 keeps those implied by the tree
+	FilePerm os.FileMode
+	// pointer, smudge or skip
+	LFS                string
+	ContentFilter      string
+	IgnoreFilterErrors bool
+	// lf, crlf or native; empty follows .gitattributes
+	EOL string
+	// Path of the manifest written into each branch, if any
+	Manifest      string
+	RespectIgnore bool
+	NoCommit      bool
+	// commit, discard or stash
+	OnResidue   string
+	AddTrailers bool
+	// Overrides the author name and email when set
+	Author object.Signature
+	// Zero uses the time of each commit
+	AuthorDate       time.Time
+	Sign             bool
+	SignKey          string
+	Stats            bool
+	AsTags           bool
+	AlsoTag          bool
+	PostBranchHook   string
+	IgnoreHookErrors bool
+	// Remote to push each branch to, and the token for HTTPS remotes
+	Push            string
+	Token           string
+	RollbackOnError bool
+	Resume          bool
+	Restart         bool
+	UseWorktree     bool
+	PreserveIndex   bool
+	Force           bool
+	SuffixTimestamp bool
+	// Workers reading file contents and rendering commit messages
+	Jobs     int
+	Progress bool
+}
+
+// TagSplits reports whether the commits of the split are tagged, with
+// --as-tags or --also-tag.
+func (o BranchOptions) TagSplits() bool {
+	return o.AsTags || o.AlsoTag
+}
+
+// CreateBranches creates a branch with a commit for every group of cfg on
+// startCommit, checking each out in the worktree of repo, which must be the
+// working directory. It returns to the original HEAD afterwards.
+func CreateBranches(ctx context.Context, repo *git.Repository, startCommit, baseCommit *object.Commit, sourceTree *object.Tree, cfg SplitConfig, renames map[string]string, opts BranchOptions) (results []BranchResult, err error) {
+	headRef, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD: %v", err)
+	}
+	author, committer, err := commitSignatures(repo, opts.Author)
+	if err != nil {
+		return nil, err
+	}
+	var signer git.Signer
+	if opts.Sign {
+		commandSigner, err := newCommitSigner(opts.SignKey)
+		if err != nil {
+			return nil, err
+		}
+		defer commandSigner.Close()
+		signer = commandSigner
+	}
+
+	results = []BranchResult{}
+	var unpushed []string
+	currentBranch := HeadName(headRef)
+	if !headRef.Name().IsBranch() && !opts.UseWorktree {
+		Infof("Warning: HEAD is detached at %s; it will be checked out again at the end instead of a branch.\n", ShortHash(currentBranch))
+	}
+	// A bare repository only gets a worktree with --use-worktree below
+	worktree, err := repo.Worktree()
+	if err != nil && !(opts.UseWorktree && err == git.ErrIsBareRepository) {
+		return nil, fmt.Errorf("failed to get worktree: %v", err)
+	}
+
+	// The groups finished by an interrupted run are kept with --resume
+	stateFile, err := statePath(repo)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := splitFingerprint(startCommit, sourceTree, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint the split: %v", err)
+	}
+	state, err := loadSplitState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := resumeSplitState(repo, stateFile, state, fingerprint, currentBranch, opts.Resume, opts.Restart)
+	if err != nil {
+		return nil, err
+	}
+	done := len(completed)
+
+	remaining, err := resolveExistingBranches(repo, SplitConfig{Branches: cfg.Branches[done:]}, currentBranch, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TagSplits() {
+		if err := checkExistingTags(repo, remaining.Branches, opts.Force); err != nil {
+			return nil, err
+		}
+	}
+	cfg.Branches = append(append([]BranchGroup{}, cfg.Branches[:done]...), remaining.Branches...)
+	results = append(results, completed...)
+
+	// With --stacked (but not --stacked-cumulative) each branch starts from
+	// the commit of the previous one
+	parentCommit := startCommit
+	appliedHunks := make(map[string][]int)
+	for i, result := range completed {
+		cfg.Branches[i].Name = result.Name
+		if !opts.Stacked || opts.StackCumulative {
+			continue
+		}
+		for file, numbers := range cfg.Branches[i].Hunks {
+			appliedHunks[file] = append(appliedHunks[file], numbers...)
+		}
+		if result.Hash != "" && !result.Skipped {
+			if parentCommit, err = repo.CommitObject(plumbing.NewHash(result.Hash)); err != nil {
+				return nil, fmt.Errorf("failed to get commit of branch '%s': %v", result.Name, err)
+			}
+		}
+	}
+
+	prefetchStart := time.Now()
+	blobs, messages, err := prefetchSplit(sourceTree, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	Verbosef("Read %d file(s) and commit messages with %d job(s) in %v\n", len(blobs), opts.Jobs, time.Since(prefetchStart))
+
+	if opts.UseWorktree {
+		worktreeRepo, removeWorktree, err := addSplitWorktree(startCommit)
+		if err != nil {
+			return nil, err
+		}
+		defer removeWorktree()
+		repo = worktreeRepo
+		if worktree, err = repo.Worktree(); err != nil {
+			return nil, fmt.Errorf("failed to get worktree: %v", err)
+		}
+	}
+
+	// With --preserve-index the changes of the checkout are stashed before the
+	// first branch and applied again once HEAD is back where it was
+	if opts.PreserveIndex && !opts.UseWorktree {
+		snapshot, err := snapshotChanges()
+		if err != nil {
+			return nil, err
+		}
+		if snapshot != "" {
+			Infof("Stashed the current changes (%s) to restore them afterwards\n", ShortHash(snapshot))
+			defer func() {
+				if head, err := repo.Head(); err != nil || head.Name() != headRef.Name() || head.Hash() != headRef.Hash() {
+					Infof("Warning: the changes stashed before the split were not restored; check out %s again and run 'git stash apply --index %s'.\n", DescribeHead(headRef), snapshot)
+					return
+				}
+				if err := restoreChanges(snapshot); err != nil {
+					Infof("Warning: %v\n", err)
+					return
+				}
+				Infof("Restored the changes stashed before the split\n")
+			}()
+		}
+	}
+
+	var created, createdTags []string
+	finished := false
+	filterNoted := false
+	// The results of the groups finished before the current one, and the
+	// branch of the current one once it is checked out
+	finishedResults := results
+	inProgress := ""
+	defer func() {
+		if errors.Is(err, ErrInterrupted) && !finished {
+			// Keep the finished groups for --resume and only undo the one
+			// that was cut short
+			var partial, partialTags []string
+			if inProgress != "" {
+				partial = []string{inProgress}
+				for _, name := range createdTags {
+					if name == inProgress {
+						partialTags = append(partialTags, name)
+					}
+				}
+			}
+			rollbackBranches(repo, worktree, headRef, partial, opts.UseWorktree)
+			removeSplitTags(repo, partialTags)
+			if len(finishedResults) == 0 {
+				removeSplitState(stateFile)
+				return
+			}
+			if err := saveSplitState(stateFile, &splitState{Fingerprint: fingerprint, Branch: currentBranch, Completed: finishedResults}); err != nil {
+				Infof("Warning: %v\n", err)
+				return
+			}
+			Infof("Kept the %d finished branch group(s); rerun with --resume to continue or --restart to start over.\n", len(finishedResults))
+			return
+		}
+		if err != nil && !finished && opts.RollbackOnError {
+			rollbackBranches(repo, worktree, headRef, created, opts.UseWorktree)
+			removeSplitTags(repo, createdTags)
+			if done == 0 {
+				removeSplitState(stateFile)
+			} else if err := saveSplitState(stateFile, &splitState{Fingerprint: fingerprint, Branch: currentBranch, Completed: completed}); err != nil {
+				Infof("Warning: %v\n", err)
+			}
+		}
+	}()
+	progress := startProgress(len(cfg.Branches), opts.Progress)
+	defer progress.stop()
+
+	for i, group := range cfg.Branches {
+		if i < done {
+			continue
+		}
+		finishedResults, inProgress = results, ""
+		if err := interrupted(ctx); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			progress.update(i)
+		}
+		if len(group.Files) == 0 {
+			Infof("Skipping branch '%s' as there are no target files.\n", group.Name)
+			results = append(results, BranchResult{Name: group.Name, Files: []string{}, Skipped: true})
+			continue
+		}
+		if groupUnchanged(group, blobs, parentCommit, baseCommit, renames, opts.IncludeDeletions) {
+			Infof("Skipping branch '%s' as none of its %d file(s) differ from its parent commit.\n", group.Name, len(group.Files))
+			results = append(results, BranchResult{Name: group.Name, Files: []string{}, Skipped: true})
+			continue
+		}
+		if err := saveSplitState(stateFile, &splitState{Fingerprint: fingerprint, Branch: currentBranch, Completed: results, InProgress: group.Name}); err != nil {
+			return nil, err
+		}
+		Infof("==> [%d/%d] Creating branch '%s' (number of target files: %d)\n", i+1, len(cfg.Branches), group.Name, len(group.Files))
+
+		// Creating the branch at its parent commit also resets the worktree from
+		// the previous split branch, so no separate checkout of BASE is needed.
+		// Whatever that branch left behind was dealt with by --on-residue, so
+		// only the first checkout has to respect the worktree.
+		checkoutStart := time.Now()
+		if err := worktree.Checkout(&git.CheckoutOptions{
+			Branch: plumbing.NewBranchReferenceName(group.Name),
+			Create: true,
+			Hash:   parentCommit.Hash,
+			Force:  len(created) > 0,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create new branch '%s': %v", group.Name, err)
+		}
+		created = append(created, group.Name)
+		inProgress = group.Name
+		Verbosef("Checked out new branch '%s' in %v\n", group.Name, time.Since(checkoutStart))
+
+		attributes, err := loadAttributes(worktree)
+		if err != nil {
+			return nil, err
+		}
+		var ignore gitignore.Matcher
+		if opts.RespectIgnore {
+			if ignore, err = loadIgnore(worktree); err != nil {
+				return nil, err
+			}
+		}
+
+		var updatedFiles, missing, converted []string
+		unchanged := 0
+		for _, file := range group.Files {
+			if err := interrupted(ctx); err != nil {
+				return nil, err
+			}
+			blob, ok := blobs[file]
+			if !ok {
+				if opts.IncludeDeletions && submoduleEntry(parentCommit, file) != nil {
+					if err := unstageSubmodule(repo, file); err != nil {
+						return nil, err
+					}
+					updatedFiles = append(updatedFiles, file)
+					Infof("Removed submodule '%s'; its directory is left in the working tree.\n", file)
+					continue
+				}
+				if _, parentErr := parentCommit.File(file); opts.IncludeDeletions && parentErr == nil {
+					if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+						return nil, fmt.Errorf("failed to delete file '%s': %v", file, err)
+					}
+					if _, err := worktree.Remove(file); err != nil {
+						return nil, fmt.Errorf("failed to stage deletion of file '%s': %v", file, err)
+					}
+					updatedFiles = append(updatedFiles, file)
+					Verbosef("Deleted: %s\n", file)
+					continue
+				}
+				if _, baseErr := baseCommit.File(file); opts.IncludeDeletions && (baseErr == nil || submoduleEntry(baseCommit, file) != nil) {
+					// Added on the base branch after the start commit
+					Verbosef("Already absent: %s\n", file)
+					continue
+				}
+				Verbosef("Missing in SOURCE branch: %s\n", file)
+				missing = append(missing, file)
+				continue
+			}
+			if ignore != nil && isIgnored(ignore, file) {
+				Infof("Warning: skipping '%s' because it matches a .gitignore rule.\n", file)
+				continue
+			}
+			if blob.Mode == filemode.Submodule {
+				// The checkout of the submodule itself is never updated, so it
+				// differs from the index without being residue
+				converted = append(converted, file)
+				if entry := submoduleEntry(parentCommit, file); entry != nil && entry.Hash == blob.Hash {
+					Verbosef("Unchanged: %s\n", file)
+					unchanged++
+					continue
+				}
+				if err := stageSubmodule(repo, file, blob.Hash); err != nil {
+					return nil, err
+				}
+				updatedFiles = append(updatedFiles, file)
+				Infof("Pointed submodule '%s' to commit %s; its content is not checked out.\n", file, ShortHash(blob.Hash.String()))
+				continue
+			}
+			if conflict := pathConflict(file); conflict != "" {
+				if conflict == file {
+					Infof("Warning: structural conflict, skipping '%s' because it is a directory in the BASE branch.\n", file)
+				} else {
+					Infof("Warning: structural conflict, skipping '%s' because '%s' is a file in the BASE branch.\n", file, conflict)
+				}
+				continue
+			}
+			filter := ""
+			if blob.Mode != filemode.Symlink {
+				filter = fileFilter(attributes, file)
+			}
+			if filter != "" && opts.LFS == "skip" {
+				Infof("Warning: skipping '%s' because it uses the '%s' filter (--lfs skip).\n", file, filter)
+				continue
+			}
+			// With --split-hunks the file gets the start content plus the hunks
+			// of this group, and of the groups below it when stacked
+			var hunkData []byte
+			numbers := group.Hunks[file]
+			if hunks := opts.Hunks[file]; hunks != nil && len(numbers) > 0 {
+				selected := make(map[int]bool)
+				for _, n := range append(appliedHunks[file], numbers...) {
+					selected[n] = true
+				}
+				hunkData = hunks.apply(selected)
+				if opts.Stacked && !opts.StackCumulative {
+					appliedHunks[file] = append(appliedHunks[file], numbers...)
+				}
+			}
+			if _, renamed := renames[file]; !renamed && hunkData == nil {
+				if parentFile, err := parentCommit.File(file); err == nil && parentFile.Hash == blob.Hash && parentFile.Mode == blob.Mode {
+					Verbosef("Unchanged: %s\n", file)
+					unchanged++
+					continue
+				}
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory '%s': %v", filepath.Dir(file), err)
+			}
+
+			fileData := blob.Data
+			if hunkData != nil {
+				fileData = hunkData
+			}
+			// Content to commit when it is not the blob of the source branch
+			stored := hunkData
+			if opts.ContentFilter != "" && blob.Mode != filemode.Symlink && filter == "" {
+				filtered, err := runContentFilter(ctx, opts.ContentFilter, file, fileData)
+				switch {
+				case err != nil && (!opts.IgnoreFilterErrors || errors.Is(err, ErrInterrupted)):
+					return nil, err
+				case err != nil:
+					Infof("Warning: %v; committing '%s' unfiltered.\n", err, file)
+				case !bytes.Equal(filtered, fileData):
+					fileData, stored = filtered, filtered
+					Verbosef("Filtered: %s\n", file)
+				}
+			}
+			// Filtered files are committed as stored in git either way; with
+			// --lfs smudge only the checkout gets their real content
+			smudged := false
+			switch {
+			case filter != "" && opts.LFS == "smudge":
+				if fileData, err = smudgeFile(filter, file, fileData); err != nil {
+					return nil, err
+				}
+				smudged = true
+			case filter != "" && !filterNoted:
+				Infof("Note: '%s' uses the '%s' filter and is checked out as stored in git (e.g. as an LFS pointer); pass --lfs smudge to check out its content or --lfs skip to leave such files out.\n", file, filter)
+				filterNoted = true
+			}
+			eol := ""
+			if blob.Mode != filemode.Symlink && filter == "" {
+				eol = fileEOL(attributes, file, fileData, opts.EOL)
+			}
+			if eol != "" {
+				fileData = convertEOL(fileData, eol)
+			}
+			if err := writeWorktreeFile(file, fileData, blob.Mode, opts.FilePerm); err != nil {
+				return nil, err
+			}
+			if eol != "" || smudged {
+				hash := blob.Hash
+				if stored != nil {
+					if hash, err = storeBlob(repo, stored); err != nil {
+						return nil, fmt.Errorf("failed to store the content of '%s': %v", file, err)
+					}
+				}
+				if err := stageBlob(repo, file, hash, blob.Mode); err != nil {
+					return nil, fmt.Errorf("failed to add file '%s' to staging: %v", file, err)
+				}
+				converted = append(converted, file)
+				if smudged {
+					Verbosef("Smudged '%s' with the '%s' filter\n", file, filter)
+				} else {
+					Verbosef("Converted line endings of '%s' to %s\n", file, eol)
+				}
+			} else if _, err := worktree.Add(file); err != nil {
+				return nil, fmt.Errorf("failed to add file '%s' to staging: %v", file, err)
+			}
+			if oldPath, ok := renames[file]; ok {
+				if err := os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
+					return nil, fmt.Errorf("failed to delete renamed file '%s': %v", oldPath, err)
+				}
+				if _, err := worktree.Remove(oldPath); err != nil {
+					return nil, fmt.Errorf("failed to stage deletion of renamed file '%s': %v", oldPath, err)
+				}
+				Verbosef("Renamed: %s -> %s\n", oldPath, file)
+			}
+			updatedFiles = append(updatedFiles, file)
+			if hunkData != nil {
+				Verbosef("Updated: %s (hunks %v)\n", file, numbers)
+			} else {
+				Verbosef("Updated: %s\n", file)
+			}
+		}
+		if opts.Manifest != "" && len(updatedFiles) > 0 {
+			if err := writeManifest(worktree, group, opts.Manifest, opts.Range); err != nil {
+				return nil, err
+			}
+			Verbosef("Wrote manifest: %s\n", opts.Manifest)
+		}
+
+		status, err := worktree.Status()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get worktree status: %v", err)
+		}
+		staged, err := restrictStagedFiles(worktree, status, parentCommit, group, renames, opts.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		residue := residualFiles(status, staged, converted)
+		commitOpts := func() *git.CommitOptions {
+			committer.When = time.Now()
+			author.When = committer.When
+			if !opts.AuthorDate.IsZero() {
+				author.When = opts.AuthorDate
+			}
+			return &git.CommitOptions{Author: author, Committer: committer, Signer: signer}
+		}
+		if len(staged) == 0 {
+			if unchanged > 0 {
+				Infof("No changes to commit in branch '%s' (%d file(s) already identical to its parent). Skipping commit.\n", group.Name, unchanged)
+			} else {
+				Infof("No changes to commit in branch '%s'. Skipping commit.\n", group.Name)
+			}
+			result := BranchResult{Name: group.Name, Hash: parentCommit.Hash.String(), Files: []string{}, Skipped: true, Missing: missing}
+			hash, err := handleResidue(worktree, group.Name, residue, opts.OnResidue, commitOpts())
+			if err != nil {
+				return nil, err
+			}
+			if !hash.IsZero() {
+				result.Hash, result.Files, result.Skipped = hash.String(), residue, false
+				if opts.Stacked && !opts.StackCumulative {
+					if parentCommit, err = repo.CommitObject(hash); err != nil {
+						return nil, fmt.Errorf("failed to get commit of branch '%s': %v", group.Name, err)
+					}
+				}
+			}
+			results = append(results, result)
+		} else if opts.NoCommit {
+			// Only one branch can hold staged changes at a time, so they are
+			// stashed before the next branch is checked out
+			if err := stashStaged(group.Name); err != nil {
+				return nil, err
+			}
+			if _, err := handleResidue(worktree, group.Name, residue, opts.OnResidue, nil); err != nil {
+				return nil, err
+			}
+			results = append(results, BranchResult{Name: group.Name, Hash: parentCommit.Hash.String(), Files: updatedFiles, Missing: missing, Stashed: true})
+			Infof("Stashed the staged files of branch '%s'\n", group.Name)
+		} else {
+			msg := messages[i]
+			if opts.AddTrailers {
+				msg = appendTrailers(msg, len(updatedFiles), opts.Range)
+			}
+			hash, err := worktree.Commit(msg, commitOpts())
+			if err != nil {
+				return nil, fmt.Errorf("failed to commit in branch '%s': %v", group.Name, err)
+			}
+			Verbosef("Created commit in %v\n", time.Since(committer.When))
+			residueHash, err := handleResidue(worktree, group.Name, residue, opts.OnResidue, commitOpts())
+			if err != nil {
+				return nil, err
+			}
+			if !residueHash.IsZero() {
+				hash = residueHash
+				updatedFiles = append(updatedFiles, residue...)
+			}
+			var stats *BranchStats
+			if opts.Stats {
+				commit, err := repo.CommitObject(hash)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get commit of branch '%s': %v", group.Name, err)
+				}
+				if stats, err = branchStats(parentCommit, commit); err != nil {
+					return nil, err
+				}
+			}
+			if opts.Stacked && !opts.StackCumulative {
+				if parentCommit, err = repo.CommitObject(hash); err != nil {
+					return nil, fmt.Errorf("failed to get commit of branch '%s': %v", group.Name, err)
+				}
+			}
+			result := BranchResult{Name: group.Name, Hash: hash.String(), Files: updatedFiles, Missing: missing, Stats: stats}
+			Infof("Committed to branch '%s' (%s)\n", group.Name, ShortHash(hash.String()))
+			if stats != nil {
+				Infof("  %s\n", stats)
+			}
+			if opts.TagSplits() {
+				tagger := *committer
+				if err := createSplitTag(repo, group.Name, hash, msg, &tagger); err != nil {
+					return nil, err
+				}
+				createdTags = append(createdTags, group.Name)
+				result.Tag = group.Name
+				Infof("Tagged '%s' (%s)\n", group.Name, ShortHash(hash.String()))
+			}
+
+			if opts.PostBranchHook != "" {
+				if err := runPostBranchHook(ctx, opts.PostBranchHook, group.Name, i+1, updatedFiles); err != nil {
+					if !opts.IgnoreHookErrors || errors.Is(err, ErrInterrupted) {
+						return nil, err
+					}
+					Infof("Warning: %v\n", err)
+				}
+				// Whatever the hook changed is not part of the branch and
+				// must not leak into the next one
+				if err := worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+					return nil, fmt.Errorf("failed to reset the worktree after the post-branch hook: %v", err)
+				}
+			}
+
+			if opts.Push != "" {
+				if err := pushBranch(ctx, repo, group.Name, opts); err != nil {
+					Infof("Warning: failed to push branch '%s' to '%s': %v\n", group.Name, opts.Push, err)
+					unpushed = append(unpushed, group.Name)
+				} else {
+					result.Pushed = true
+					Infof("Pushed branch '%s' to '%s'\n", group.Name, opts.Push)
+				}
+			}
+			results = append(results, result)
+		}
+	}
+
+	progress.update(len(cfg.Branches))
+	progress.stop()
+	if err := saveSplitState(stateFile, &splitState{Fingerprint: fingerprint, Branch: currentBranch, Completed: results}); err != nil {
+		return nil, err
+	}
+
+	if opts.UseWorktree {
+		finished = true
+		removeSplitState(stateFile)
+		if opts.AsTags {
+			removeTaggedBranches(repo, results)
+		}
+		Infof("Completed. The checkout of %s was left untouched.\n", DescribeHead(headRef))
+	} else {
+		if err := worktree.Checkout(originalCheckout(headRef, len(created) > 0)); err != nil {
+			return nil, fmt.Errorf("failed to checkout back to original %s: %v", DescribeHead(headRef), err)
+		}
+		finished = true
+		removeSplitState(stateFile)
+		if opts.AsTags {
+			removeTaggedBranches(repo, results)
+		}
+		Infof("Completed. Returned to original %s.\n", DescribeHead(headRef))
+	}
+	if opts.NoCommit {
+		if err := printStashInstructions(results); err != nil {
+			return results, err
+		}
+	}
+
+	if len(unpushed) > 0 {
+		Infof("The following branches were committed locally but not pushed to '%s':\n", opts.Push)
+		for _, name := range unpushed {
+			Infof("- %s\n", name)
+		}
+		return results, fmt.Errorf("failed to push %d branch(es) to '%s'", len(unpushed), opts.Push)
+	}
+	return results, nil
+}
+
+// resolveExistingBranches checks every branch group against the existing
+// local branches before anything is created. Conflicts are an error unless
+// --force (delete the old branch) or --suffix-timestamp (rename) is set.
+func resolveExistingBranches(repo *git.Repository, cfg SplitConfig, currentBranch string, opts BranchOptions) (SplitConfig, error) {
+	existing := make(map[string]bool)
+	// Existing branches by each of their parent directories
+	existingDirs := make(map[string]string)
+	refs, err := repo.Branches()
+	if err != nil {
+		return cfg, fmt.Errorf("failed to list branches: %v", err)
+	}
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		existing[name] = true
+		for i := 0; i < len(name); i++ {
+			if name[i] == '/' {
+				existingDirs[name[:i]] = name
+			}
+		}
+		return nil
+	})
+
+	var clashes []string
+	for _, group := range cfg.Branches {
+		if len(group.Files) == 0 {
+			continue
+		}
+		other, ok := existingDirs[group.Name]
+		if !ok {
+			other = refClash(group.Name, existing)
+		}
+		if other != "" {
+			clashes = append(clashes, fmt.Sprintf("'%s' clashes with the existing branch '%s'", group.Name, other))
+		}
+	}
+	if len(clashes) > 0 {
+		return cfg, ConfigError(fmt.Errorf("%d branch name(s) cannot be created, as git cannot have a branch and a directory of the same name (rename them in the config):\n  %s", len(clashes), strings.Join(clashes, "\n  ")))
+	}
+
+	suffix := time.Now().Format("20060102150405")
+	branches := make([]BranchGroup, len(cfg.Branches))
+	copy(branches, cfg.Branches)
+
+	var conflicts []string
+	for i, group := range branches {
+		if len(group.Files) == 0 || !existing[group.Name] {
+			continue
+		}
+		switch {
+		case opts.SuffixTimestamp:
+			branches[i].Name = fmt.Sprintf("%s-%s", group.Name, suffix)
+			Infof("Branch '%s' already exists, using '%s' instead\n", group.Name, branches[i].Name)
+		case opts.Force:
+			if group.Name == currentBranch {
+				return cfg, fmt.Errorf("cannot recreate branch '%s' because it is currently checked out", group.Name)
+			}
+			if err := repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(group.Name)); err != nil {
+				return cfg, fmt.Errorf("failed to delete existing branch '%s': %v", group.Name, err)
+			}
+			Infof("Deleted existing branch '%s'\n", group.Name)
+		default:
+			conflicts = append(conflicts, group.Name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return cfg, fmt.Errorf("branches already exist: %s (delete them, rename them in the config, or pass --force or --suffix-timestamp)", strings.Join(conflicts, ", "))
+	}
+	return SplitConfig{Branches: branches}, nil
+}
+
+// writeWorktreeFile writes data to file honoring the mode stored in git:
+// symlinks are recreated as real symlinks and executables keep their bit,
+// unless --file-mode sets the permissions of every regular file.
+func writeWorktreeFile(file string, data []byte, mode filemode.FileMode, filePerm os.FileMode) error {
+	// Never write through a symlink left by the base branch
+	if info, err := os.Lstat(file); err == nil && (mode == filemode.Symlink || info.Mode()&os.ModeSymlink != 0) {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to replace file '%s': %v", file, err)
+		}
+	}
+
+	if mode == filemode.Symlink {
+		if err := os.Symlink(string(data), file); err != nil {
+			return fmt.Errorf("failed to create symlink '%s': %v", file, err)
+		}
+		return nil
+	}
+
+	perm := os.FileMode(0644)
+	if mode == filemode.Executable {
+		perm = 0755
+	}
+	if filePerm != 0 {
+		perm = filePerm
+	}
+	if err := os.WriteFile(file, data, perm); err != nil {
+		return fmt.Errorf("failed to write file '%s': %v", file, err)
+	}
+	// WriteFile keeps the permissions of a file that already exists
+	if err := os.Chmod(file, perm); err != nil {
+		return fmt.Errorf("failed to set permissions of file '%s': %v", file, err)
+	}
+	return nil
+}
+
+// gitFileMode returns the mode a file of the source tree is committed with.
+// Git only records the executable bit, so --file-mode decides it for regular
+// files and executables; symlinks and submodules keep theirs.
+func gitFileMode(mode filemode.FileMode, filePerm os.FileMode) filemode.FileMode {
+	if filePerm == 0 || (mode != filemode.Regular && mode != filemode.Executable && mode != filemode.Deprecated) {
+		return mode
+	}
+	if filePerm&0100 != 0 {
+		return filemode.Executable
+	}
+	return filemode.Regular
+}
+
+// pathConflict returns the path that keeps file from being written to the
+// worktree: a parent directory that exists as a file or symlink, or file
+// itself when it exists as a directory. It returns "" when there is none.
+func pathConflict(file string) string {
+	for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if info, err := os.Lstat(dir); err == nil && !info.IsDir() {
+			return dir
+		}
+	}
+	if info, err := os.Lstat(file); err == nil && info.IsDir() {
+		return file
+	}
+	return ""
+}
+
+// rollbackBranches returns to the original branch, discarding any partial
+// changes, and deletes the branches created during a failed run.
+func rollbackBranches(repo *git.Repository, worktree *git.Worktree, headRef *plumbing.Reference, created []string, useWorktree bool) {
+	if len(created) > 0 {
+		Infof("Rolling back the branches created so far...\n")
+	}
+	// Only force a checkout once HEAD has moved, so changes made before the
+	// split started are never discarded. With --use-worktree the main
+	// checkout never moved.
+	head, err := repo.Head()
+	moved := err != nil || head.Name() != headRef.Name() || head.Hash() != headRef.Hash()
+	if !useWorktree && moved {
+		if err := worktree.Checkout(originalCheckout(headRef, true)); err != nil {
+			Infof("Warning: failed to checkout back to original %s, branches were not removed: %v\n", DescribeHead(headRef), err)
+			return
+		}
+	}
+	for _, name := range created {
+		if err := repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(name)); err != nil {
+			Infof("Warning: failed to remove branch '%s': %v\n", name, err)
+			continue
+		}
+		Infof("Removed branch '%s'\n", name)
+	}
+}
+
+// groupUnchanged reports whether committing group on parent would change
+// nothing, so that the group can be skipped before its branch is checked out.
+// Files missing from both trees are not unchanged; the split reports them.
+func groupUnchanged(group BranchGroup, blobs map[string]*sourceBlob, parent, baseCommit *object.Commit, renames map[string]string, includeDeletions bool) bool {
+	for _, file := range group.Files {
+		if _, renamed := renames[file]; renamed || len(group.Hunks[file]) > 0 {
+			return false
+		}
+		parentFile, parentErr := parent.File(file)
+		blob, ok := blobs[file]
+		if !ok {
+			if _, baseErr := baseCommit.File(file); !includeDeletions || parentErr == nil || baseErr != nil {
+				return false
+			}
+			continue
+		}
+		if blob.Mode == filemode.Submodule {
+			if entry := submoduleEntry(parent, file); entry == nil || entry.Hash != blob.Hash {
+				return false
+			}
+			continue
+		}
+		if parentErr != nil || parentFile.Hash != blob.Hash || parentFile.Mode != blob.Mode {
+			return false
+		}
+	}
+	return true
+}
+
+// restrictStagedFiles makes sure only the files of group (and the old paths
+// of renamed files) are staged for the commit, unstaging anything else, and
+// returns the staged files that remain.
+func restrictStagedFiles(worktree *git.Worktree, status git.Status, baseCommit *object.Commit, group BranchGroup, renames map[string]string, manifest string) ([]string, error) {
+	groupFiles := make(map[string]bool)
+	for _, file := range group.Files {
+		groupFiles[file] = true
+		if oldPath, ok := renames[file]; ok {
+			groupFiles[oldPath] = true
+		}
+	}
+	if manifest != "" {
+		groupFiles[manifest] = true
+	}
+
+	var staged, extras []string
+	for file, fileStatus := range status {
+		if fileStatus.Staging == git.Unmodified || fileStatus.Staging == git.Untracked {
+			continue
+		}
+		if groupFiles[file] {
+			staged = append(staged, file)
+		} else {
+			extras = append(extras, file)
+		}
+	}
+	if len(extras) > 0 {
+		sort.Strings(extras)
+		Infof("Warning: unstaging files not assigned to branch '%s': %s\n", group.Name, strings.Join(extras, ", "))
+		if err := worktree.Reset(&git.ResetOptions{
+			Commit: baseCommit.Hash,
+			Mode:   git.MixedReset,
+			Files:  extras,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to unstage files not assigned to branch '%s': %v", group.Name, err)
+		}
+	}
+	return staged, nil
+}
+
+// pushBranch pushes the branch of a split group, and its tag with --as-tags
+// (instead of the branch) or --also-tag.
+func pushBranch(ctx context.Context, repo *git.Repository, branchName string, opts BranchOptions) error {
+	var refs []plumbing.ReferenceName
+	if !opts.AsTags {
+		refs = append(refs, plumbing.NewBranchReferenceName(branchName))
+	}
+	if opts.TagSplits() {
+		refs = append(refs, plumbing.NewTagReferenceName(branchName))
+	}
+	pushOpts := &git.PushOptions{RemoteName: opts.Push}
+	for _, ref := range refs {
+		pushOpts.RefSpecs = append(pushOpts.RefSpecs, config.RefSpec(fmt.Sprintf("%s:%s", ref, ref)))
+	}
+	// SSH remotes fall back to the SSH agent when no explicit auth is given
+	if opts.Token != "" {
+		pushOpts.Auth = &http.BasicAuth{Username: "git", Password: opts.Token}
+	}
+	if err := repo.PushContext(ctx, pushOpts); err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
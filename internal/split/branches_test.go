@@ -0,0 +1,447 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// initTestRepo creates a repository in a temporary directory with a
+// committer in its config and makes it the working directory, as
+// CreateBranches expects. Only go-git is used, so no git binary is needed.
+func initTestRepo(t testing.TB) (*git.Repository, *git.Worktree) {
+	t.Helper()
+	// Keep the git config and environment of the machine out of the test
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	for _, key := range []string{"GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL", "GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL"} {
+		t.Setenv(key, "")
+	}
+	logOut := LogOut
+	LogOut = io.Discard
+	t.Cleanup(func() { LogOut = logOut })
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.User.Name, cfg.User.Email = "Test", "test@example.com"
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return repo, worktree
+}
+
+// commitTestFiles writes files, relative to the working directory, and
+// commits every change of the worktree.
+func commitTestFiles(t testing.TB, repo *git.Repository, worktree *git.Worktree, msg string, files map[string]string) *object.Commit {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := worktree.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := worktree.Commit(msg, &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+// splitTestRepo returns a test repository with base committed on master and
+// source committed on top of it on the branch source. master is checked out.
+func splitTestRepo(t testing.TB, base, source map[string]string) (repo *git.Repository, baseCommit, sourceCommit *object.Commit) {
+	t.Helper()
+	repo, worktree := initTestRepo(t)
+	baseCommit = commitTestFiles(t, repo, worktree, "base", base)
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("source"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	sourceCommit = commitTestFiles(t, repo, worktree, "source", source)
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}); err != nil {
+		t.Fatal(err)
+	}
+	return repo, baseCommit, sourceCommit
+}
+
+// branchFiles returns the content of every file in the tree of branch.
+func branchFiles(t testing.TB, repo *git.Repository, branch string) map[string]string {
+	t.Helper()
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		t.Fatalf("branch '%s': %v", branch, err)
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	iter, err := commit.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = iter.ForEach(func(file *object.File) error {
+		content, err := file.Contents()
+		files[file.Name] = content
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCreateBranchesWithoutGit(t *testing.T) {
+	t.Setenv("PATH", "")
+	if _, err := exec.LookPath("git"); err == nil {
+		t.Fatal("git is still on PATH")
+	}
+	repo, baseCommit, sourceCommit := splitTestRepo(t,
+		map[string]string{"README.md": "readme\n", "a.txt": "a\n"},
+		map[string]string{"a.txt": "a changed\n", "dir/b.txt": "b\n", "c.txt": "c\n"},
+	)
+	sourceTree, err := sourceCommit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := SplitConfig{Branches: []BranchGroup{
+		{Name: "split-1", Files: []string{"a.txt", "dir/b.txt"}},
+		{Name: "split-2", Files: []string{"c.txt"}},
+	}}
+	opts := BranchOptions{Messages: MessageOptions{Mode: "files"}, OnResidue: "stash", Jobs: 2}
+
+	results, err := CreateBranches(context.Background(), repo, baseCommit, baseCommit, sourceTree, cfg, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for i, group := range cfg.Branches {
+		result := results[i]
+		if result.Name != group.Name || result.Skipped || !reflect.DeepEqual(result.Files, group.Files) {
+			t.Errorf("result %d = %+v, want branch '%s' with %v", i, result, group.Name, group.Files)
+		}
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(group.Name), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref.Hash().String() != result.Hash {
+			t.Errorf("branch '%s' points at %s, the result says %s", group.Name, ref.Hash(), result.Hash)
+		}
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(commit.ParentHashes) != 1 || commit.ParentHashes[0] != baseCommit.Hash {
+			t.Errorf("branch '%s' has parents %v, want the base commit", group.Name, commit.ParentHashes)
+		}
+		if commit.Committer.Name != "Test" || commit.Committer.Email != "test@example.com" {
+			t.Errorf("branch '%s' was committed by %s <%s>", group.Name, commit.Committer.Name, commit.Committer.Email)
+		}
+		if want := "Update diff files: [" + strings.Join(group.Files, " ") + "]"; commit.Message != want {
+			t.Errorf("branch '%s' has the message %q, want %q", group.Name, commit.Message, want)
+		}
+	}
+
+	wantFiles := map[string]map[string]string{
+		"split-1": {"README.md": "readme\n", "a.txt": "a changed\n", "dir/b.txt": "b\n"},
+		"split-2": {"README.md": "readme\n", "a.txt": "a\n", "c.txt": "c\n"},
+	}
+	for branch, want := range wantFiles {
+		if got := branchFiles(t, repo, branch); !reflect.DeepEqual(got, want) {
+			t.Errorf("branch '%s' has the files %v, want %v", branch, got, want)
+		}
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Name() != plumbing.Master {
+		t.Errorf("HEAD is %s after the split, want %s", head.Name(), plumbing.Master)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsClean() {
+		t.Errorf("the worktree is not clean after the split:\n%s", status)
+	}
+}
+
+// The commit logs are still read with git log, so --sort mtime, --since and
+// --commit-msg-mode latest need the git binary.
+func TestCommitLogsNeedGit(t *testing.T) {
+	t.Setenv("PATH", "")
+	_, baseCommit, sourceCommit := splitTestRepo(t,
+		map[string]string{"a.txt": "a\n"},
+		map[string]string{"a.txt": "a changed\n"},
+	)
+	baseTree, err := baseCommit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceTree, err := sourceCommit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := []DiffFile{{Name: "a.txt", Action: ActionModify}}
+
+	tests := []struct {
+		name string
+		run  func(logs *CommitLogs) error
+	}{
+		{"sort mtime", func(logs *CommitLogs) error {
+			_, err := DiffFiles(context.Background(), baseTree, sourceTree, DiffOptions{IncludeModifies: true, Sort: "mtime", Logs: logs})
+			return err
+		}},
+		{"since", func(logs *CommitLogs) error {
+			_, err := FilterSince(diff, time.Now().Add(-time.Hour), logs)
+			return err
+		}},
+		{"latest", func(logs *CommitLogs) error {
+			_, err := CommitMessage(BranchGroup{Name: "split-1", Files: []string{"a.txt"}}, MessageOptions{Mode: "latest", Logs: logs})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(NewCommitLogs(Range{Base: "master", Source: "source"}))
+			if err == nil || !strings.Contains(err.Error(), "failed to get commit logs") {
+				t.Errorf("got error %v, want the git log failure", err)
+			}
+		})
+	}
+}
+
+func TestCreateBranchesFileModes(t *testing.T) {
+	repo, worktree := initTestRepo(t)
+	baseCommit := commitTestFiles(t, repo, worktree, "base", map[string]string{"README.md": "readme\n"})
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("source"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("run.sh", []byte("#!/bin/sh\necho run\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("README.md", "link"); err != nil {
+		t.Fatal(err)
+	}
+	sourceCommit := commitTestFiles(t, repo, worktree, "source", nil)
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}); err != nil {
+		t.Fatal(err)
+	}
+	sourceTree, err := sourceCommit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := SplitConfig{Branches: []BranchGroup{{Name: "split-1", Files: []string{"link", "run.sh"}}}}
+	opts := BranchOptions{Messages: MessageOptions{Mode: "files"}, OnResidue: "stash", Jobs: 1}
+	if _, err := CreateBranches(context.Background(), repo, baseCommit, baseCommit, sourceTree, cfg, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files are staged from the worktree, so the modes show that a real
+	// executable and a real symlink were written
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName("split-1"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]filemode.FileMode{"run.sh": filemode.Executable, "link": filemode.Symlink} {
+		entry, err := tree.FindEntry(file)
+		if err != nil {
+			t.Fatalf("'%s' is not in the branch: %v", file, err)
+		}
+		if entry.Mode != want {
+			t.Errorf("'%s' has the mode %o, want %o", file, entry.Mode, want)
+		}
+	}
+	if files := branchFiles(t, repo, "split-1"); files["link"] != "README.md" {
+		t.Errorf("the symlink points to %q, want %q", files["link"], "README.md")
+	}
+}
+
+func TestCreateBranchesEOLAttribute(t *testing.T) {
+	repo, baseCommit, sourceCommit := splitTestRepo(t,
+		map[string]string{".gitattributes": "*.txt text eol=crlf\n", "a.txt": "one\n"},
+		map[string]string{"a.txt": "one\ntwo\n"},
+	)
+	sourceTree, err := sourceCommit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hook runs before the next checkout, so it sees the worktree of
+	// the branch
+	checkout := filepath.Join(t.TempDir(), "a.txt")
+	cfg := SplitConfig{Branches: []BranchGroup{{Name: "split-1", Files: []string{"a.txt"}}}}
+	opts := BranchOptions{
+		Messages:       MessageOptions{Mode: "files"},
+		OnResidue:      "stash",
+		Jobs:           1,
+		PostBranchHook: "cp a.txt '" + checkout + "'",
+	}
+	if _, err := CreateBranches(context.Background(), repo, baseCommit, baseCommit, sourceTree, cfg, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(checkout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "one\r\ntwo\r\n"; got != want {
+		t.Errorf("the worktree had %q, want %q", got, want)
+	}
+	if got, want := branchFiles(t, repo, "split-1")["a.txt"], "one\ntwo\n"; got != want {
+		t.Errorf("the committed blob has %q, want %q", got, want)
+	}
+}
+
+// The hunks are numbered against the merge-base the branches start from, so
+// changes made on the base after the fork are neither hunks nor undone.
+func TestCreateBranchesHunksFromMergeBase(t *testing.T) {
+	repo, worktree := initTestRepo(t)
+	fork := commitTestFiles(t, repo, worktree, "fork", map[string]string{"a.txt": "1\n2\n3\n4\n5\n6\n7\n8\n9\n"})
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("source"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	sourceCommit := commitTestFiles(t, repo, worktree, "source", map[string]string{"a.txt": "1\ntwo\n3\n4\n5\n6\n7\neight\n9\n"})
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}); err != nil {
+		t.Fatal(err)
+	}
+	baseCommit := commitTestFiles(t, repo, worktree, "base", map[string]string{"a.txt": "1\n2\n3\n4\nfive\n6\n7\n8\n9\n"})
+
+	startCommit, err := StartCommit(repo, Range{Base: "master", Source: "source"}, "", baseCommit, sourceCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if startCommit.Hash != fork.Hash {
+		t.Fatalf("the split starts from %s, want the fork point %s", startCommit.Hash, fork.Hash)
+	}
+	startTree, err := startCommit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceTree, err := sourceCommit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := SplitConfig{Branches: []BranchGroup{
+		{Name: "split-1", Files: []string{"a.txt"}, Hunks: map[string][]int{"a.txt": {1}}},
+		{Name: "split-2", Files: []string{"a.txt"}, Hunks: map[string][]int{"a.txt": {2}}},
+	}}
+	hunks, err := LoadSplitHunks(cfg, startTree, sourceTree, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hunks["a.txt"].count; got != 2 {
+		t.Fatalf("a.txt has %d hunks, want the 2 of the source", got)
+	}
+	opts := BranchOptions{Messages: MessageOptions{Mode: "files"}, OnResidue: "stash", Jobs: 1, Hunks: hunks}
+	if _, err := CreateBranches(context.Background(), repo, startCommit, baseCommit, sourceTree, cfg, nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"split-1": "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n",
+		"split-2": "1\n2\n3\n4\n5\n6\n7\neight\n9\n",
+	}
+	for branch, content := range want {
+		if got := branchFiles(t, repo, branch)["a.txt"]; got != content {
+			t.Errorf("branch '%s' has a.txt %q, want %q", branch, got, content)
+		}
+	}
+}
+
+// BenchmarkCreateBranches splits 100 changed files of a 200 file repository
+// into 50 branches.
+func BenchmarkCreateBranches(b *testing.B) {
+	const groups, filesPerGroup = 50, 2
+	base := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		base[fmt.Sprintf("dir%d/file%d.txt", i%20, i)] = fmt.Sprintf("base %d\n", i)
+	}
+	source := make(map[string]string)
+	cfg := SplitConfig{}
+	for i := 0; i < groups; i++ {
+		group := BranchGroup{Name: fmt.Sprintf("split-%d", i+1)}
+		for j := 0; j < filesPerGroup; j++ {
+			n := i*filesPerGroup + j
+			file := fmt.Sprintf("dir%d/file%d.txt", n%20, n)
+			source[file] = fmt.Sprintf("source %d\n", n)
+			group.Files = append(group.Files, file)
+		}
+		cfg.Branches = append(cfg.Branches, group)
+	}
+	repo, baseCommit, sourceCommit := splitTestRepo(b, base, source)
+	sourceTree, err := sourceCommit.Tree()
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Each run replaces the branches of the one before
+	opts := BranchOptions{Messages: MessageOptions{Mode: "files"}, OnResidue: "stash", Jobs: 4, Force: true}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		results, err := CreateBranches(context.Background(), repo, baseCommit, baseCommit, sourceTree, cfg, nil, opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(results) != groups {
+			b.Fatalf("got %d results, want %d", len(results), groups)
+		}
+	}
+}
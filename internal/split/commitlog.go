@@ -0,0 +1,85 @@
+package split
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommitLogs holds the subjects and last commit dates of the source branch
+// commits per file, newest first. They are read with a single git log when
+// first needed, so that prefetch workers and --since or --sort mtime don't
+// each spawn one per file.
+type CommitLogs struct {
+	rng      Range
+	once     sync.Once
+	subjects map[string][]string
+	dates    map[string]time.Time
+	err      error
+}
+
+// NewCommitLogs returns the commit logs of the commits on rng.Source that are
+// not on rng.Base.
+func NewCommitLogs(rng Range) *CommitLogs {
+	return &CommitLogs{rng: rng}
+}
+
+// Subjects returns the subjects of the commits that touched file, newest
+// first.
+func (l *CommitLogs) Subjects(file string) ([]string, error) {
+	l.once.Do(l.load)
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.subjects[file], nil
+}
+
+// LastCommitTime returns the committer date of the most recent commit that
+// touched file.
+func (l *CommitLogs) LastCommitTime(file string) (time.Time, bool, error) {
+	l.once.Do(l.load)
+	if l.err != nil {
+		return time.Time{}, false, l.err
+	}
+	last, ok := l.dates[file]
+	return last, ok, nil
+}
+
+func (l *CommitLogs) load() {
+	// -z keeps paths unquoted. Each commit is prefixed with \x01 to tell it
+	// apart from the file names that follow it. Renames are listed as a
+	// deletion and an addition, which is what a per-file git log matches.
+	cmd := exec.Command("git", "log", "-z", "--no-renames", "--name-only", "--format=%x01%cI %s", l.rng.Base+".."+l.rng.Source)
+	out, err := cmd.Output()
+	if err != nil {
+		l.err = fmt.Errorf("failed to get commit logs: %v", err)
+		return
+	}
+	l.subjects = make(map[string][]string)
+	l.dates = make(map[string]time.Time)
+	var subject string
+	var date time.Time
+	for _, field := range strings.Split(string(out), "\x00") {
+		if strings.HasPrefix(field, "\x01") {
+			dateText, rest, _ := strings.Cut(field[1:], " ")
+			if date, err = time.Parse(time.RFC3339, dateText); err != nil {
+				l.err = fmt.Errorf("failed to parse commit date '%s': %v", dateText, err)
+				return
+			}
+			subject = rest
+			continue
+		}
+		file := strings.TrimPrefix(field, "\n")
+		if file == "" {
+			continue
+		}
+		if _, ok := l.dates[file]; !ok {
+			l.dates[file] = date
+		}
+		if subject != "" {
+			l.subjects[file] = append(l.subjects[file], subject)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package split
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CommitRanges groups the first-parent history of sourceCommit after
+// startCommit, oldest first, in ranges of perBranch commits.
+func CommitRanges(startCommit, sourceCommit *object.Commit, perBranch int) ([][]*object.Commit, error) {
+	commits, err := sourceCommits(startCommit, sourceCommit)
+	if err != nil {
+		return nil, err
+	}
+	var ranges [][]*object.Commit
+	for start := 0; start < len(commits); start += perBranch {
+		end := start + perBranch
+		if end > len(commits) {
+			end = len(commits)
+		}
+		ranges = append(ranges, commits[start:end])
+	}
+	return ranges, nil
+}
+
+// sourceCommits returns the first-parent history of the source branch after
+// startCommit, oldest first.
+func sourceCommits(startCommit, sourceCommit *object.Commit) ([]*object.Commit, error) {
+	var commits []*object.Commit
+	for commit := sourceCommit; commit.Hash != startCommit.Hash; {
+		commits = append(commits, commit)
+		if commit.NumParents() == 0 {
+			return nil, fmt.Errorf("source commit %s does not descend from %s", ShortHash(sourceCommit.Hash.String()), ShortHash(startCommit.Hash.String()))
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent of commit %s: %v", ShortHash(commit.Hash.String()), err)
+		}
+		commit = parent
+	}
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// PrintCommitRanges writes the branches --split-by commits would create to w.
+func PrintCommitRanges(w io.Writer, ranges [][]*object.Commit, names []string) {
+	fmt.Fprintln(w, "\nDry run: no branches were created and the repository was not changed.")
+	for i, commitRange := range ranges {
+		fmt.Fprintf(w, "==> Branch '%s' (number of commits: %d)\n", names[i], len(commitRange))
+		for _, commit := range commitRange {
+			fmt.Fprintf(w, "- %s %s\n", ShortHash(commit.Hash.String()), commitSubject(commit))
+		}
+	}
+}
+
+// SplitByCommits implements --split-by commits: each of ranges (see
+// CommitRanges) is squashed into a single commit with the tree after its last
+// commit, stacked on the branch of the previous range, and stored as the
+// branch of the same index in names. No worktree checkout is needed.
+func SplitByCommits(ctx context.Context, repo *git.Repository, startCommit *object.Commit, ranges [][]*object.Commit, names []string, opts BranchOptions) (results []BranchResult, err error) {
+	var cfg SplitConfig
+	for _, name := range names {
+		cfg.Branches = append(cfg.Branches, BranchGroup{Name: name})
+	}
+
+	headRef, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD: %v", err)
+	}
+	if cfg, err = resolveExistingBranches(repo, cfg, headRef.Name().Short(), opts); err != nil {
+		return nil, err
+	}
+	if opts.TagSplits() {
+		if err := checkExistingTags(repo, cfg.Branches, opts.Force); err != nil {
+			return nil, err
+		}
+	}
+	author, committer, err := commitSignatures(repo, opts.Author)
+	if err != nil {
+		return nil, err
+	}
+	var signer git.Signer
+	if opts.Sign {
+		commandSigner, err := newCommitSigner(opts.SignKey)
+		if err != nil {
+			return nil, err
+		}
+		defer commandSigner.Close()
+		signer = commandSigner
+	}
+
+	results = []BranchResult{}
+	var unpushed []string
+	var created, createdTags []string
+	finished := false
+	// The branch and tag of the range being committed, until its result is
+	// recorded
+	inProgress, inProgressTag := "", ""
+	defer func() {
+		if err == nil || finished {
+			return
+		}
+		if !errors.Is(err, ErrInterrupted) && opts.RollbackOnError {
+			rollbackBranches(repo, nil, headRef, created, true)
+			removeSplitTags(repo, createdTags)
+			results = nil
+			return
+		}
+		// Otherwise the finished ranges are kept and returned, and only the
+		// one that was cut short is undone. No checkout ever moved.
+		if inProgress != "" {
+			rollbackBranches(repo, nil, headRef, []string{inProgress}, true)
+		}
+		if inProgressTag != "" {
+			removeSplitTags(repo, []string{inProgressTag})
+		}
+	}()
+	parent := startCommit
+	for i, commitRange := range ranges {
+		if err := interrupted(ctx); err != nil {
+			return results, err
+		}
+		name := cfg.Branches[i].Name
+		last := commitRange[len(commitRange)-1]
+		files, err := changedFiles(parent, last)
+		if err != nil {
+			return results, err
+		}
+
+		// A single commit keeps its message; a squashed range lists the
+		// subjects of its commits like --commit-msg-mode latest. --message
+		// replaces both
+		msg := strings.TrimSpace(last.Message)
+		if opts.Messages.Fixed != nil {
+			if msg, err = renderFixedMessage(opts.Messages.Fixed, BranchGroup{Name: name, Files: files}); err != nil {
+				return results, err
+			}
+		} else if len(commitRange) > 1 {
+			var subjects []string
+			for _, commit := range commitRange {
+				subjects = append(subjects, commitSubject(commit))
+			}
+			msg = strings.Join(subjects, "\n")
+		}
+		if opts.AddTrailers {
+			msg = appendTrailers(msg, len(files), opts.Range)
+		}
+		committer.When = time.Now()
+		author.When = committer.When
+		if !opts.AuthorDate.IsZero() {
+			author.When = opts.AuthorDate
+		}
+		commit := &object.Commit{
+			Author:       *author,
+			Committer:    *committer,
+			Message:      msg,
+			TreeHash:     last.TreeHash,
+			ParentHashes: []plumbing.Hash{parent.Hash},
+		}
+		hash, err := storeCommit(repo, commit, signer)
+		if err != nil {
+			return results, fmt.Errorf("failed to commit in branch '%s': %v", name, err)
+		}
+		// The commits are built without a checkout, so --as-tags needs no
+		// branch at all
+		if !opts.AsTags {
+			if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), hash)); err != nil {
+				return results, fmt.Errorf("failed to create branch '%s': %v", name, err)
+			}
+			created = append(created, name)
+			inProgress = name
+		}
+		// The new commit has the tree of the last commit of the range
+		var stats *BranchStats
+		if opts.Stats {
+			if stats, err = branchStats(parent, last); err != nil {
+				return results, err
+			}
+		}
+		if parent, err = repo.CommitObject(hash); err != nil {
+			return results, fmt.Errorf("failed to get commit of branch '%s': %v", name, err)
+		}
+		Infof("Committed %d commit(s) to branch '%s' (%s)\n", len(commitRange), name, ShortHash(hash.String()))
+
+		result := BranchResult{Name: name, Hash: hash.String(), Files: files, Stats: stats}
+		if stats != nil {
+			Infof("  %s\n", stats)
+		}
+		if opts.TagSplits() {
+			tagger := *committer
+			if err := createSplitTag(repo, name, hash, msg, &tagger); err != nil {
+				return results, err
+			}
+			createdTags = append(createdTags, name)
+			inProgressTag = name
+			result.Tag = name
+			Infof("Tagged '%s' (%s)\n", name, ShortHash(hash.String()))
+		}
+		if opts.Push != "" {
+			if err := pushBranch(ctx, repo, name, opts); err != nil {
+				Infof("Warning: failed to push branch '%s' to '%s': %v\n", name, opts.Push, err)
+				unpushed = append(unpushed, name)
+			} else {
+				result.Pushed = true
+				Infof("Pushed branch '%s' to '%s'\n", name, opts.Push)
+			}
+		}
+		results = append(results, result)
+		inProgress, inProgressTag = "", ""
+	}
+
+	// The branches that failed to push are kept for another try
+	finished = true
+	if len(unpushed) > 0 {
+		return results, fmt.Errorf("failed to push %d branch(es) to '%s'", len(unpushed), opts.Push)
+	}
+	return results, nil
+}
+
+func commitSubject(commit *object.Commit) string {
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	return subject
+}
+
+// changedFiles lists the paths that differ between the trees of two commits.
+func changedFiles(from, to *object.Commit) ([]string, error) {
+	fromTree, err := from.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of commit %s: %v", ShortHash(from.Hash.String()), err)
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of commit %s: %v", ShortHash(to.Hash.String()), err)
+	}
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commits: %v", err)
+	}
+	files := []string{}
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// storeCommit writes commit to the object database, signed with signer when
+// it is set, the way worktree.Commit does.
+func storeCommit(repo *git.Repository, commit *object.Commit, signer git.Signer) (plumbing.Hash, error) {
+	if signer != nil {
+		unsigned := repo.Storer.NewEncodedObject()
+		if err := commit.EncodeWithoutSignature(unsigned); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		reader, err := unsigned.Reader()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		signature, err := signer.Sign(reader)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to sign commit: %v", err)
+		}
+		commit.PGPSignature = string(signature)
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
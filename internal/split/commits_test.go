@@ -0,0 +1,91 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// failingSigner sets up --sign with a gpg.program that signs the first commit
+// and fails on every commit after it.
+func failingSigner(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake gpg.program is a shell script")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git config is read with the git binary")
+	}
+	program := filepath.Join(t.TempDir(), "gpg")
+	script := `#!/bin/sh
+if [ -e "$0.signed" ]; then
+	echo "no more signatures" >&2
+	exit 1
+fi
+touch "$0.signed"
+echo "-----BEGIN PGP SIGNATURE-----"
+echo "-----END PGP SIGNATURE-----"
+`
+	if err := os.WriteFile(program, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{"user.signingkey": "test", "gpg.program": program} {
+		if out, err := exec.Command("git", "config", "--global", key, value).CombinedOutput(); err != nil {
+			t.Fatalf("git config %s: %v: %s", key, err, out)
+		}
+	}
+}
+
+// When a later range fails, the branches and tags of the finished ranges are
+// kept and returned, unless --rollback-on-error removes them.
+func TestSplitByCommitsFailure(t *testing.T) {
+	for _, rollback := range []bool{false, true} {
+		t.Run(fmt.Sprintf("rollback=%v", rollback), func(t *testing.T) {
+			repo, worktree := initTestRepo(t)
+			failingSigner(t)
+			baseCommit := commitTestFiles(t, repo, worktree, "base", map[string]string{"a.txt": "a\n"})
+			if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("source"), Create: true}); err != nil {
+				t.Fatal(err)
+			}
+			commitTestFiles(t, repo, worktree, "add b", map[string]string{"b.txt": "b\n"})
+			sourceCommit := commitTestFiles(t, repo, worktree, "add c", map[string]string{"c.txt": "c\n"})
+			if err := worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}); err != nil {
+				t.Fatal(err)
+			}
+			ranges, err := CommitRanges(baseCommit, sourceCommit, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{"split-1", "split-2"}
+			opts := BranchOptions{Messages: MessageOptions{Mode: "files"}, AlsoTag: true, Sign: true, RollbackOnError: rollback}
+
+			results, err := SplitByCommits(context.Background(), repo, baseCommit, ranges, names, opts)
+			if err == nil || !strings.Contains(err.Error(), "failed to sign commit") {
+				t.Fatalf("got error %v, want the signing failure", err)
+			}
+			if rollback {
+				if results != nil {
+					t.Errorf("got results %+v after the rollback", results)
+				}
+			} else if len(results) != 1 || results[0].Name != "split-1" || results[0].Tag != "split-1" {
+				t.Fatalf("got results %+v, want the finished split-1", results)
+			}
+			for _, ref := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName("split-1"), plumbing.NewTagReferenceName("split-1")} {
+				if _, err := repo.Reference(ref, false); (err == nil) == rollback {
+					t.Errorf("%s exists: %v, want %v", ref, err == nil, !rollback)
+				}
+			}
+			if _, err := repo.Reference(plumbing.NewBranchReferenceName("split-2"), false); err == nil {
+				t.Error("the failed branch split-2 was created")
+			}
+		})
+	}
+}
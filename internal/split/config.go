@@ -0,0 +1,42 @@
+// Package split holds the split config, the logic that builds it from the
+// diff files and the git side of a split. Its functions take their options as
+// parameters and know nothing of the command line.
+package split
+
+// Struct definitions for YAML configuration
+type BranchGroup struct {
+	Name  string   `yaml:"name" json:"name" toml:"name"`
+	Files []string `yaml:"files" json:"files" toml:"files"`
+	// With --split-hunks, the hunk numbers (from 1) of a file that go to
+	// this group; the file must also be listed in Files
+	Hunks map[string][]int `yaml:"hunks,omitempty" json:"hunks,omitempty" toml:"hunks,omitempty"`
+}
+
+type SplitConfig struct {
+	Defaults *ConfigDefaults `yaml:"defaults,omitempty" json:"defaults,omitempty" toml:"defaults,omitempty"`
+	Branches []BranchGroup   `yaml:"branches" json:"branches" toml:"branches"`
+}
+
+// Settings for the run that can be given in the split config. Flags passed on
+// the command line take precedence.
+type ConfigDefaults struct {
+	CommitMsgMode  string `yaml:"commit_msg_mode,omitempty" json:"commitMsgMode,omitempty" toml:"commit_msg_mode,omitempty"`
+	CommitTemplate string `yaml:"commit_template,omitempty" json:"commitTemplate,omitempty" toml:"commit_template,omitempty"`
+	Push           string `yaml:"push,omitempty" json:"push,omitempty" toml:"push,omitempty"`
+	Stacked        *bool  `yaml:"stacked,omitempty" json:"stacked,omitempty" toml:"stacked,omitempty"`
+	Sign           *bool  `yaml:"sign,omitempty" json:"sign,omitempty" toml:"sign,omitempty"`
+}
+
+// A file that differs between the base and source trees
+type DiffFile struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// Previous path of a renamed file
+	From string `json:"from,omitempty"`
+	// Number of added and deleted lines, only computed with --split-by size
+	Lines int `json:"-"`
+}
+
+// Files listed in a group with this name are deliberately left out of the
+// split; no branch is created for the group.
+const KeepGroupName = "__keep__"
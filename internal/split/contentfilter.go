@@ -0,0 +1,29 @@
+package split
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runContentFilter pipes the content of file through command
+// (--content-filter), run by the shell with the path of the file in
+// SPLIT_FILE, and returns its output.
+func runContentFilter(ctx context.Context, command, file string, data []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), "SPLIT_FILE="+file)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if stopped := interrupted(ctx); stopped != nil {
+			return nil, stopped
+		}
+		return nil, fmt.Errorf("content filter failed on '%s': %v: %s", file, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
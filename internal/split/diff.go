@@ -0,0 +1,197 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// Change actions reported for diff files
+const (
+	ActionAdd    = "add"
+	ActionModify = "modify"
+	ActionDelete = "delete"
+	ActionRename = "rename"
+)
+
+// DiffOptions selects the diff files DiffFiles reports. The fields mirror the
+// flags of the same names.
+type DiffOptions struct {
+	// Pair deleted and added files into renames with a similarity of at
+	// least RenameThreshold percent, or identical content with ExactRenames
+	DetectRenames   bool
+	RenameThreshold int
+	ExactRenames    bool
+	// Which change actions count as diff files
+	IncludeAdds      bool
+	IncludeModifies  bool
+	IncludeDeletions bool
+	IncludeRenames   bool
+	// Count the changed lines of every file, for --split-by size
+	CountLines bool
+	// Clean paths the files must lie under (see CleanPathPrefixes)
+	PathPrefixes []string
+	Include      []string
+	Exclude      []string
+	// path, mtime or diff (see sortDiffFiles)
+	Sort string
+	// Read for Sort mtime
+	Logs *CommitLogs
+}
+
+// DiffFiles returns the files that differ between the base and source trees,
+// filtered and ordered according to opts.
+func DiffFiles(ctx context.Context, baseTree, sourceTree *object.Tree, opts DiffOptions) ([]DiffFile, error) {
+	start := time.Now()
+	// go-git pairs the deletes and adds of the tree diff into renames
+	treeOpts := &object.DiffTreeOptions{DetectRenames: false}
+	if opts.DetectRenames {
+		treeOpts = &object.DiffTreeOptions{
+			DetectRenames:    true,
+			RenameScore:      uint(opts.RenameThreshold),
+			OnlyExactRenames: opts.ExactRenames,
+		}
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, baseTree, sourceTree, treeOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff: %v", err)
+	}
+	Verbosef("Computed tree diff (%d changes) in %v\n", len(changes), time.Since(start))
+
+	includedActions := map[string]bool{
+		ActionAdd:    opts.IncludeAdds,
+		ActionModify: opts.IncludeModifies,
+		ActionDelete: opts.IncludeDeletions,
+		ActionRename: opts.IncludeRenames,
+	}
+
+	fileSet := make(map[string]bool)
+	var diffFiles []DiffFile
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get action for change: %v", err)
+		}
+		diffFile := DiffFile{Name: change.To.Name}
+		switch {
+		case action == merkletrie.Insert:
+			diffFile.Action = ActionAdd
+		case action == merkletrie.Delete:
+			diffFile.Name = change.From.Name
+			diffFile.Action = ActionDelete
+		case change.From.Name != change.To.Name:
+			diffFile.Action = ActionRename
+			diffFile.From = change.From.Name
+		default:
+			diffFile.Action = ActionModify
+		}
+		if !includedActions[diffFile.Action] {
+			continue
+		}
+		if diffFile.Name != "" && !fileSet[diffFile.Name] {
+			if opts.CountLines {
+				if diffFile.Lines, err = changedLines(change); err != nil {
+					return nil, err
+				}
+			}
+			diffFiles = append(diffFiles, diffFile)
+			fileSet[diffFile.Name] = true
+		}
+	}
+
+	if len(opts.PathPrefixes) > 0 {
+		var scoped []DiffFile
+		for _, file := range diffFiles {
+			if underPathPrefix(opts.PathPrefixes, file.Name) {
+				scoped = append(scoped, file)
+			}
+		}
+		Infof("Excluded %d of %d diff file(s) outside --path %s\n", len(diffFiles)-len(scoped), len(diffFiles), strings.Join(opts.PathPrefixes, ", "))
+		diffFiles = scoped
+	}
+	if len(opts.Exclude) > 0 || len(opts.Include) > 0 {
+		var filtered []DiffFile
+		for _, file := range diffFiles {
+			if len(opts.Include) > 0 && !MatchAnyGlob(opts.Include, file.Name) {
+				continue
+			}
+			if MatchAnyGlob(opts.Exclude, file.Name) {
+				continue
+			}
+			filtered = append(filtered, file)
+		}
+		Infof("Filtered out %d of %d diff file(s) with --include/--exclude\n", len(diffFiles)-len(filtered), len(diffFiles))
+		diffFiles = filtered
+	}
+
+	if err := sortDiffFiles(diffFiles, opts.Sort, opts.Logs); err != nil {
+		return nil, err
+	}
+	Infof("Diff files count: %d\n", len(diffFiles))
+	return diffFiles, nil
+}
+
+// changedLines returns the number of lines added and deleted by change.
+func changedLines(change *object.Change) (int, error) {
+	patch, err := change.Patch()
+	if err != nil {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		return 0, fmt.Errorf("failed to get patch for '%s': %v", name, err)
+	}
+	lines := 0
+	for _, stat := range patch.Stats() {
+		lines += stat.Addition + stat.Deletion
+	}
+	return lines, nil
+}
+
+// FilesFromDiff turns the paths of --files-from into diff files, using the
+// base and source trees to tell additions, modifications and deletions apart.
+// Every path must exist in the source tree, or in the base tree when
+// deletions are included.
+func FilesFromDiff(files []string, baseTree, sourceTree *object.Tree, includeDeletions bool) ([]DiffFile, error) {
+	var diff []DiffFile
+	for _, file := range files {
+		_, baseErr := baseTree.File(file)
+		if _, err := sourceTree.File(file); err != nil {
+			if includeDeletions && baseErr == nil {
+				diff = append(diff, DiffFile{Name: file, Action: ActionDelete})
+				continue
+			}
+			return nil, fmt.Errorf("'%s' does not exist in SOURCE branch", file)
+		}
+		action := ActionModify
+		if baseErr != nil {
+			action = ActionAdd
+		}
+		diff = append(diff, DiffFile{Name: file, Action: action})
+	}
+	Infof("Diff files count: %d (from --files-from)\n", len(diff))
+	return diff, nil
+}
+
+func FileNames(diffFiles []DiffFile) []string {
+	names := make([]string, 0, len(diffFiles))
+	for _, file := range diffFiles {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+// Renames maps the new path of each renamed diff file to its old path.
+func Renames(diffFiles []DiffFile) map[string]string {
+	renames := make(map[string]string)
+	for _, file := range diffFiles {
+		if file.Action == ActionRename {
+			renames[file.Name] = file.From
+		}
+	}
+	return renames
+}
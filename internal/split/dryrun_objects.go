@@ -0,0 +1,214 @@
+package split
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// A file of a tree built by --dry-run=objects
+type treeEntry struct {
+	Hash plumbing.Hash
+	Mode filemode.FileMode
+}
+
+// PrintDryRunObjects builds the commit of every group the way CreateBranches
+// would, but only in an in-memory object storer: the trees and commits are
+// never written to the repository, and neither HEAD nor the worktree moves.
+// Rules that depend on a checkout (.gitignore, --lfs, --eol and the
+// manifest) are not applied. The commits are written to w.
+func PrintDryRunObjects(w io.Writer, repo *git.Repository, startCommit *object.Commit, sourceTree *object.Tree, cfg SplitConfig, renames map[string]string, opts BranchOptions) error {
+	author, committer, err := commitSignatures(repo, opts.Author)
+	if err != nil {
+		return err
+	}
+	storer := memory.NewStorage()
+	startFiles, err := treeFiles(startCommit)
+	if err != nil {
+		return err
+	}
+	parent, parentFiles := startCommit.Hash, startFiles
+	parentTree := startCommit.TreeHash
+	appliedHunks := make(map[string][]int)
+
+	fmt.Fprintln(w, "\nCommits built in memory (commit hashes change with the commit time):")
+	for _, group := range cfg.Branches {
+		if len(group.Files) == 0 {
+			continue
+		}
+		files := make(map[string]treeEntry, len(parentFiles))
+		for file, entry := range parentFiles {
+			files[file] = entry
+		}
+		for _, file := range group.Files {
+			source, err := sourceTree.FindEntry(file)
+			if err != nil || source.Mode == filemode.Dir {
+				// Deleted, or missing from both trees
+				if opts.IncludeDeletions {
+					delete(files, file)
+				}
+				continue
+			}
+			entry := treeEntry{Hash: source.Hash, Mode: gitFileMode(source.Mode, opts.FilePerm)}
+			if hunks, numbers := opts.Hunks[file], group.Hunks[file]; hunks != nil && len(numbers) > 0 {
+				selected := make(map[int]bool)
+				for _, n := range append(appliedHunks[file], numbers...) {
+					selected[n] = true
+				}
+				if entry.Hash, err = storeObject(storer, plumbing.BlobObject, hunks.apply(selected)); err != nil {
+					return err
+				}
+				if opts.Stacked && !opts.StackCumulative {
+					appliedHunks[file] = append(appliedHunks[file], numbers...)
+				}
+			}
+			files[file] = entry
+			if oldPath, ok := renames[file]; ok {
+				delete(files, oldPath)
+			}
+		}
+
+		treeHash, err := buildTree(storer, files)
+		if err != nil {
+			return fmt.Errorf("failed to build the tree of branch '%s': %v", group.Name, err)
+		}
+		if treeHash == parentTree {
+			fmt.Fprintf(w, "%s: no changes, would be skipped\n", group.Name)
+			continue
+		}
+		msg, err := CommitMessage(group, opts.Messages)
+		if err != nil {
+			return err
+		}
+		if opts.AddTrailers {
+			msg = appendTrailers(msg, len(group.Files), opts.Range)
+		}
+		committer.When = time.Now()
+		author.When = committer.When
+		if !opts.AuthorDate.IsZero() {
+			author.When = opts.AuthorDate
+		}
+		commit := &object.Commit{
+			Author:       *author,
+			Committer:    *committer,
+			Message:      msg,
+			TreeHash:     treeHash,
+			ParentHashes: []plumbing.Hash{parent},
+		}
+		obj := storer.NewEncodedObject()
+		if err := commit.Encode(obj); err != nil {
+			return fmt.Errorf("failed to encode the commit of branch '%s': %v", group.Name, err)
+		}
+		fmt.Fprintf(w, "%s: tree %s, commit %s\n", group.Name, treeHash, obj.Hash())
+		if opts.Stacked && !opts.StackCumulative {
+			parent, parentFiles, parentTree = obj.Hash(), files, treeHash
+		}
+	}
+	return nil
+}
+
+// treeFiles lists every file of the tree of commit by path.
+func treeFiles(commit *object.Commit) (map[string]treeEntry, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of commit %s: %v", ShortHash(commit.Hash.String()), err)
+	}
+	files := make(map[string]treeEntry)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err != nil {
+			break
+		}
+		if entry.Mode != filemode.Dir {
+			files[name] = treeEntry{Hash: entry.Hash, Mode: entry.Mode}
+		}
+	}
+	return files, nil
+}
+
+// A directory of a tree built by --dry-run=objects
+type treeNode struct {
+	files map[string]treeEntry
+	dirs  map[string]*treeNode
+}
+
+// buildTree stores the trees of files, keyed by their paths, and returns the
+// hash of the root tree.
+func buildTree(storer *memory.Storage, files map[string]treeEntry) (plumbing.Hash, error) {
+	root := &treeNode{files: map[string]treeEntry{}, dirs: map[string]*treeNode{}}
+	for file, entry := range files {
+		node := root
+		parts := strings.Split(file, "/")
+		for _, dir := range parts[:len(parts)-1] {
+			child, ok := node.dirs[dir]
+			if !ok {
+				child = &treeNode{files: map[string]treeEntry{}, dirs: map[string]*treeNode{}}
+				node.dirs[dir] = child
+			}
+			node = child
+		}
+		node.files[parts[len(parts)-1]] = entry
+	}
+	return storeTree(storer, root, "")
+}
+
+func storeTree(storer *memory.Storage, node *treeNode, dir string) (plumbing.Hash, error) {
+	var entries []object.TreeEntry
+	for name, entry := range node.files {
+		if _, ok := node.dirs[name]; ok {
+			return plumbing.ZeroHash, fmt.Errorf("'%s' is both a file and a directory", path.Join(dir, name))
+		}
+		entries = append(entries, object.TreeEntry{Name: name, Mode: entry.Mode, Hash: entry.Hash})
+	}
+	for name, child := range node.dirs {
+		hash, err := storeTree(storer, child, path.Join(dir, name))
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash})
+	}
+	// Git sorts directories as if their name ended with a slash
+	sortKey := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortKey(entries[i]) < sortKey(entries[j])
+	})
+
+	obj := storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return storer.SetEncodedObject(obj)
+}
+
+func storeObject(storer *memory.Storage, kind plumbing.ObjectType, data []byte) (plumbing.Hash, error) {
+	obj := storer.NewEncodedObject()
+	obj.SetType(kind)
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return storer.SetEncodedObject(obj)
+}
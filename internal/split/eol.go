@@ -0,0 +1,97 @@
+package split
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// loadAttributes reads the .gitattributes files of the checked out worktree.
+func loadAttributes(worktree *git.Worktree) (gitattributes.Matcher, error) {
+	patterns, err := gitattributes.ReadPatterns(worktree.Filesystem, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitattributes: %v", err)
+	}
+	return gitattributes.NewMatcher(patterns), nil
+}
+
+// fileEOL returns the line ending ("lf" or "crlf") that file should be written
+// with, or an empty string when its content must be written as stored in git.
+// eolMode (--eol) wins over the eol attribute, but files marked -text or binary
+// are never converted.
+func fileEOL(matcher gitattributes.Matcher, file string, data []byte, eolMode string) string {
+	attrs, _ := matcher.Match(strings.Split(file, "/"), []string{"text", "eol", "binary"})
+	if attr, ok := attrs["binary"]; ok && attr.IsSet() {
+		return ""
+	}
+	text, hasText := attrs["text"]
+	if hasText && text.IsUnset() {
+		return ""
+	}
+
+	eol := eolMode
+	if eol == "" {
+		if attr, ok := attrs["eol"]; ok && attr.IsValueSet() {
+			eol = attr.Value()
+		}
+	}
+	if eol == "native" {
+		eol = "lf"
+		if runtime.GOOS == "windows" {
+			eol = "crlf"
+		}
+	}
+	if eol != "lf" && eol != "crlf" {
+		return ""
+	}
+	// Without an explicit text attribute, leave content that looks binary alone
+	if !(hasText && text.IsSet()) && bytes.IndexByte(data, 0) != -1 {
+		return ""
+	}
+	return eol
+}
+
+func convertEOL(data []byte, eol string) []byte {
+	normalized := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	if eol == "crlf" {
+		return bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+	}
+	return normalized
+}
+
+// stageBlob stages file in the index with the blob stored in git rather than
+// hashing the working tree content, so that line ending conversions made for
+// the checkout do not leak into the commit.
+func stageBlob(repo *git.Repository, file string, hash plumbing.Hash, mode filemode.FileMode) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %v", err)
+	}
+	entry, err := idx.Entry(file)
+	if err == index.ErrEntryNotFound {
+		entry = idx.Add(file)
+	} else if err != nil {
+		return fmt.Errorf("failed to read index entry for '%s': %v", file, err)
+	}
+
+	info, err := os.Lstat(file)
+	if err != nil {
+		return fmt.Errorf("failed to stat file '%s': %v", file, err)
+	}
+	entry.Hash = hash
+	entry.Mode = mode
+	entry.Size = uint32(info.Size())
+	entry.ModifiedAt = info.ModTime()
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package split
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+func TestFileEOL(t *testing.T) {
+	var patterns []gitattributes.MatchAttribute
+	for _, line := range []string{"*.txt text eol=crlf", "*.bat eol=crlf", "*.bin binary", "*.raw -text eol=crlf"} {
+		attrs, err := gitattributes.ReadAttributes(strings.NewReader(line+"\n"), nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, attrs...)
+	}
+	matcher := gitattributes.NewMatcher(patterns)
+
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		eolMode string
+		want    string
+	}{
+		{"text eol=crlf", "a.txt", "one\n", "", "crlf"},
+		{"text eol=crlf with a NUL byte", "a.txt", "one\x00\n", "", "crlf"},
+		{"--eol wins", "a.txt", "one\n", "lf", "lf"},
+		{"eol without text", "run.bat", "one\n", "", "crlf"},
+		{"eol without text looks binary", "run.bat", "one\x00\n", "", ""},
+		{"binary", "a.bin", "one\n", "crlf", ""},
+		{"-text", "a.raw", "one\n", "", ""},
+		{"no attributes", "a.go", "one\n", "", ""},
+		{"no attributes with --eol", "a.go", "one\n", "crlf", "crlf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileEOL(matcher, tt.file, []byte(tt.data), tt.eolMode); got != tt.want {
+				t.Errorf("fileEOL(%q, %q) = %q, want %q", tt.file, tt.eolMode, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package split
+
+import (
+	"errors"
+)
+
+// Errors that callers may want to tell apart with errors.Is
+var (
+	// The source, base or --from revision does not exist
+	ErrBranchNotFound = errors.New("no such branch, tag or revision")
+	// The working tree has uncommitted changes and --allow-dirty is not set
+	ErrDirtyWorktree = errors.New("working tree is dirty")
+	// The source and base point to the same commit
+	ErrNothingToSplit = errors.New("there is nothing to split")
+	// Files of the split config exist in neither the source nor the base
+	// tree and --ignore-missing is not set
+	ErrMissingFiles = errors.New("some files of the split config do not exist in the source branch")
+	// The split was stopped by SIGINT, SIGTERM or --timeout
+	ErrInterrupted = errors.New("interrupted")
+	// The split config, edited or given with --config, is invalid
+	ErrInvalidConfig = errors.New("invalid split config")
+)
+
+// ConfigError marks err as a problem of the split config, so that it matches
+// ErrInvalidConfig while keeping its message.
+func ConfigError(err error) error {
+	return &invalidConfigError{err}
+}
+
+type invalidConfigError struct {
+	err error
+}
+
+func (e *invalidConfigError) Error() string { return e.err.Error() }
+
+func (e *invalidConfigError) Unwrap() error { return e.err }
+
+func (e *invalidConfigError) Is(target error) bool { return target == ErrInvalidConfig }
@@ -0,0 +1,375 @@
+package split
+
+import (
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Options selects how Generate groups the diff files. The fields mirror the
+// flags of the same names.
+type Options struct {
+	// count, dir, ext or size
+	SplitBy        string
+	FilesPerBranch int
+	NumBranches    int
+	DirDepth       int
+	GroupByPackage bool
+	// Keep test files in the group of the source file they test, matched
+	// by TestPatterns (see TestSources)
+	KeepTestsTogether bool
+	TestPatterns      []string
+	// BranchName returns the name of the index-th group (1-based); key is
+	// the grouping directory with --split-by dir, the extension with
+	// --split-by ext and empty otherwise
+	BranchName func(index int, key string) (string, error)
+}
+
+// Tree is the part of a git tree that Generate reads to group Go files by
+// package; *object.Tree implements it.
+type Tree interface {
+	File(path string) (*object.File, error)
+}
+
+// Generate builds the split config for the diff files according to opts.
+func Generate(diff []DiffFile, tree Tree, opts Options) (SplitConfig, error) {
+	diffFiles := make([]string, len(diff))
+	for i, file := range diff {
+		diffFiles[i] = file.Name
+	}
+	switch opts.SplitBy {
+	case "dir":
+		return byDir(diffFiles, opts)
+	case "ext":
+		return byExt(diffFiles, opts)
+	case "size":
+		return bySize(diff, opts)
+	}
+	if opts.GroupByPackage {
+		return byPackage(diffFiles, tree, opts)
+	}
+
+	var groups [][]string
+	if opts.KeepTestsTogether {
+		groups = fillUnits(testUnits(diffFiles, opts.TestPatterns), opts.FilesPerBranch)
+	} else {
+		for start := 0; start < len(diffFiles); start += opts.FilesPerBranch {
+			end := start + opts.FilesPerBranch
+			if end > len(diffFiles) {
+				end = len(diffFiles)
+			}
+			groups = append(groups, diffFiles[start:end])
+		}
+	}
+
+	var cfg SplitConfig
+	for i, files := range groups {
+		name, err := opts.BranchName(i+1, "")
+		if err != nil {
+			return SplitConfig{}, err
+		}
+		cfg.Branches = append(cfg.Branches, BranchGroup{Name: name, Files: files})
+	}
+	return cfg, nil
+}
+
+// CapBranchGroups limits cfg to max groups and handles the files of the
+// remaining ones according to overflow: pack adds them to the last group,
+// keep lists them in the KeepGroupName group and drop leaves them out.
+func CapBranchGroups(cfg SplitConfig, max int, overflow string) SplitConfig {
+	if max == 0 || len(cfg.Branches) <= max {
+		return cfg
+	}
+	var rest []string
+	for _, group := range cfg.Branches[max:] {
+		rest = append(rest, group.Files...)
+	}
+
+	// cfg's groups must not change, so the kept ones are copied
+	capped := SplitConfig{Defaults: cfg.Defaults, Branches: append([]BranchGroup{}, cfg.Branches[:max]...)}
+	switch overflow {
+	case "pack":
+		last := &capped.Branches[max-1]
+		last.Files = append(append([]string{}, last.Files...), rest...)
+	case "keep":
+		capped.Branches = append(capped.Branches, BranchGroup{Name: KeepGroupName, Files: rest})
+	}
+	return capped
+}
+
+// byPackage keeps the Go files of each package in the same branch group,
+// packing whole packages into groups of up to FilesPerBranch files. A package
+// with more files than that is split by count on its own.
+func byPackage(diffFiles []string, tree Tree, opts Options) (SplitConfig, error) {
+	packages := GoPackages(diffFiles, tree)
+	if opts.KeepTestsTogether {
+		// Go tests already share the key of their package
+		for test, source := range TestSources(diffFiles, opts.TestPatterns) {
+			if _, ok := packages[test]; ok {
+				continue
+			}
+			if _, ok := packages[source]; !ok {
+				packages[source] = "file:" + source
+			}
+			packages[test] = packages[source]
+		}
+	}
+	unitIndex := make(map[string]int)
+	var units [][]string
+	for _, file := range diffFiles {
+		pkg, ok := packages[file]
+		if !ok {
+			units = append(units, []string{file})
+			continue
+		}
+		idx, ok := unitIndex[pkg]
+		if !ok {
+			idx = len(units)
+			unitIndex[pkg] = idx
+			units = append(units, nil)
+		}
+		units[idx] = append(units[idx], file)
+	}
+
+	var cfg SplitConfig
+	for i, files := range PackUnits(units, opts.FilesPerBranch) {
+		name, err := opts.BranchName(i+1, "")
+		if err != nil {
+			return SplitConfig{}, err
+		}
+		cfg.Branches = append(cfg.Branches, BranchGroup{Name: name, Files: files})
+	}
+	return cfg, nil
+}
+
+// GoPackages maps each .go diff file to a key identifying its package: the
+// directory plus the name from the package clause, with external _test
+// packages folded into the package they test. Files that cannot be read from
+// the tree (e.g. deletions) take the package of their directory.
+func GoPackages(diffFiles []string, tree Tree) map[string]string {
+	packages := make(map[string]string)
+	dirPackage := make(map[string]string)
+	var unknown []string
+	for _, file := range diffFiles {
+		if path.Ext(file) != ".go" {
+			continue
+		}
+		name, err := goPackageName(tree, file)
+		if err != nil {
+			unknown = append(unknown, file)
+			continue
+		}
+		key := path.Dir(file) + ":" + name
+		packages[file] = key
+		if _, ok := dirPackage[path.Dir(file)]; !ok {
+			dirPackage[path.Dir(file)] = key
+		}
+	}
+	for _, file := range unknown {
+		if key, ok := dirPackage[path.Dir(file)]; ok {
+			packages[file] = key
+		} else {
+			packages[file] = path.Dir(file) + ":"
+		}
+	}
+	return packages
+}
+
+func goPackageName(tree Tree, file string) (string, error) {
+	f, err := tree.File(file)
+	if err != nil {
+		return "", err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return "", err
+	}
+	parsed, err := parser.ParseFile(token.NewFileSet(), file, content, parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(parsed.Name.Name, "_test"), nil
+}
+
+// PackUnits packs units of files that belong together into groups of at most
+// size files, in order. Units larger than size are split into chunks.
+func PackUnits(units [][]string, size int) [][]string {
+	var groups [][]string
+	var current []string
+	for _, unit := range units {
+		if len(unit) > size {
+			if len(current) > 0 {
+				groups = append(groups, current)
+				current = nil
+			}
+			for start := 0; start < len(unit); start += size {
+				end := start + size
+				if end > len(unit) {
+					end = len(unit)
+				}
+				groups = append(groups, unit[start:end])
+			}
+			continue
+		}
+		if len(current)+len(unit) > size {
+			groups = append(groups, current)
+			current = nil
+		}
+		current = append(current, unit...)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// bySize spreads the diff files over NumBranches groups so that each group
+// has about the same number of changed lines. Files (or a source file with
+// its tests) are assigned largest first to the group with the fewest lines so
+// far, and keep their diff order within a group.
+func bySize(diff []DiffFile, opts Options) (SplitConfig, error) {
+	index := make(map[string]int, len(diff))
+	diffFiles := make([]string, len(diff))
+	for i, file := range diff {
+		index[file.Name] = i
+		diffFiles[i] = file.Name
+	}
+	units := make([][]string, len(diffFiles))
+	for i, file := range diffFiles {
+		units[i] = []string{file}
+	}
+	if opts.KeepTestsTogether {
+		units = testUnits(diffFiles, opts.TestPatterns)
+	}
+	lines := make([]int, len(units))
+	for u, unit := range units {
+		for _, file := range unit {
+			lines[u] += SizeLines(diff[index[file]])
+		}
+	}
+
+	count := opts.NumBranches
+	if count > len(units) {
+		count = len(units)
+	}
+	order := make([]int, len(units))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return lines[order[a]] > lines[order[b]]
+	})
+	totals := make([]int, count)
+	assigned := make([]int, len(diff))
+	for _, u := range order {
+		smallest := 0
+		for g := 1; g < count; g++ {
+			if totals[g] < totals[smallest] {
+				smallest = g
+			}
+		}
+		totals[smallest] += lines[u]
+		for _, file := range units[u] {
+			assigned[index[file]] = smallest
+		}
+	}
+
+	var cfg SplitConfig
+	for g := 0; g < count; g++ {
+		name, err := opts.BranchName(g+1, "")
+		if err != nil {
+			return SplitConfig{}, err
+		}
+		group := BranchGroup{Name: name, Files: []string{}}
+		for idx, file := range diff {
+			if assigned[idx] == g {
+				group.Files = append(group.Files, file.Name)
+			}
+		}
+		cfg.Branches = append(cfg.Branches, group)
+	}
+	return cfg, nil
+}
+
+// SizeLines is the weight of file when splitting by size: its changed lines,
+// or 1 for binary files, which have no line stats but still need a review.
+func SizeLines(file DiffFile) int {
+	if file.Lines == 0 {
+		return 1
+	}
+	return file.Lines
+}
+
+func byDir(diffFiles []string, opts Options) (SplitConfig, error) {
+	groupIndex := make(map[string]int)
+	var cfg SplitConfig
+	for _, file := range diffFiles {
+		dir := GroupDir(file, opts.DirDepth)
+		idx, ok := groupIndex[dir]
+		if !ok {
+			idx = len(cfg.Branches)
+			name, err := opts.BranchName(idx+1, dir)
+			if err != nil {
+				return SplitConfig{}, err
+			}
+			groupIndex[dir] = idx
+			cfg.Branches = append(cfg.Branches, BranchGroup{Name: name})
+		}
+		cfg.Branches[idx].Files = append(cfg.Branches[idx].Files, file)
+	}
+	return cfg, nil
+}
+
+// Extension key of the files that have none with --split-by ext
+const NoExtKey = "other"
+
+// byExt makes one group per file extension, in the order the extensions first
+// appear in the diff.
+func byExt(diffFiles []string, opts Options) (SplitConfig, error) {
+	groupIndex := make(map[string]int)
+	var cfg SplitConfig
+	for _, file := range diffFiles {
+		ext := FileExt(file)
+		idx, ok := groupIndex[ext]
+		if !ok {
+			idx = len(cfg.Branches)
+			name, err := opts.BranchName(idx+1, ext)
+			if err != nil {
+				return SplitConfig{}, err
+			}
+			groupIndex[ext] = idx
+			cfg.Branches = append(cfg.Branches, BranchGroup{Name: name})
+		}
+		cfg.Branches[idx].Files = append(cfg.Branches[idx].Files, file)
+	}
+	return cfg, nil
+}
+
+// FileExt returns the lowercased extension of file without the dot, such as
+// "go" for main.go, or NoExtKey when it has none. The leading dot of a
+// dotfile like .gitignore does not start an extension.
+func FileExt(file string) string {
+	base := strings.TrimLeft(path.Base(file), ".")
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(base), "."))
+	if ext == "" {
+		return NoExtKey
+	}
+	return ext
+}
+
+// GroupDir returns the leading directory components of a repository path,
+// up to depth levels. Files at the repository root yield an empty string.
+func GroupDir(file string, depth int) string {
+	parts := strings.Split(file, "/")
+	if len(parts) == 1 {
+		return ""
+	}
+	if depth > len(parts)-1 {
+		depth = len(parts) - 1
+	}
+	return strings.Join(parts[:depth], "/")
+}
@@ -0,0 +1,288 @@
+package split
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// fakeTree serves file contents from a map, as the source tree does for
+// --group-by-package.
+type fakeTree map[string]string
+
+func (t fakeTree) File(name string) (*object.File, error) {
+	content, ok := t[name]
+	if !ok {
+		return nil, object.ErrFileNotFound
+	}
+	storage := memory.NewStorage()
+	obj := storage.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	blob, err := object.DecodeBlob(obj)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewFile(name, filemode.Regular, blob), nil
+}
+
+func diffOf(names ...string) []DiffFile {
+	diff := make([]DiffFile, len(names))
+	for i, name := range names {
+		diff[i] = DiffFile{Name: name, Action: "modify"}
+	}
+	return diff
+}
+
+// testBranchName names groups "split-<index>" or "split-<key>".
+func testBranchName(index int, key string) (string, error) {
+	if key != "" {
+		return "split-" + key, nil
+	}
+	return fmt.Sprintf("split-%d", index), nil
+}
+
+func groupFiles(cfg SplitConfig) map[string][]string {
+	groups := make(map[string][]string, len(cfg.Branches))
+	for _, group := range cfg.Branches {
+		groups[group.Name] = group.Files
+	}
+	return groups
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name string
+		diff []DiffFile
+		tree fakeTree
+		opts Options
+		want map[string][]string
+	}{
+		{
+			name: "count",
+			diff: diffOf("a.go", "b.go", "c.go", "d.go", "e.go"),
+			opts: Options{SplitBy: "count", FilesPerBranch: 2},
+			want: map[string][]string{
+				"split-1": {"a.go", "b.go"},
+				"split-2": {"c.go", "d.go"},
+				"split-3": {"e.go"},
+			},
+		},
+		{
+			name: "dir",
+			diff: diffOf("cmd/app/main.go", "pkg/x/x.go", "cmd/tool/main.go", "README.md"),
+			opts: Options{SplitBy: "dir", DirDepth: 1},
+			want: map[string][]string{
+				"split-cmd": {"cmd/app/main.go", "cmd/tool/main.go"},
+				"split-pkg": {"pkg/x/x.go"},
+				"split-3":   {"README.md"},
+			},
+		},
+		{
+			name: "dir depth 2",
+			diff: diffOf("cmd/app/main.go", "cmd/tool/main.go", "cmd/app/flags.go"),
+			opts: Options{SplitBy: "dir", DirDepth: 2},
+			want: map[string][]string{
+				"split-cmd/app":  {"cmd/app/main.go", "cmd/app/flags.go"},
+				"split-cmd/tool": {"cmd/tool/main.go"},
+			},
+		},
+		{
+			name: "ext",
+			diff: diffOf("main.go", "README.MD", "docs/guide.md", "Makefile", ".gitignore"),
+			opts: Options{SplitBy: "ext"},
+			want: map[string][]string{
+				"split-go":    {"main.go"},
+				"split-md":    {"README.MD", "docs/guide.md"},
+				"split-other": {"Makefile", ".gitignore"},
+			},
+		},
+		{
+			name: "size",
+			diff: []DiffFile{
+				{Name: "big.go", Lines: 100},
+				{Name: "mid.go", Lines: 60},
+				{Name: "small.go", Lines: 30},
+				{Name: "image.png"},
+			},
+			opts: Options{SplitBy: "size", NumBranches: 2},
+			want: map[string][]string{
+				"split-1": {"big.go"},
+				"split-2": {"mid.go", "small.go", "image.png"},
+			},
+		},
+		{
+			name: "size with more branches than files",
+			diff: []DiffFile{{Name: "a.go", Lines: 5}, {Name: "b.go", Lines: 5}},
+			opts: Options{SplitBy: "size", NumBranches: 5},
+			want: map[string][]string{
+				"split-1": {"a.go"},
+				"split-2": {"b.go"},
+			},
+		},
+		{
+			name: "package",
+			diff: diffOf("x/a.go", "y/c.go", "x/b.go", "x/b_test.go", "notes.txt"),
+			tree: fakeTree{
+				"x/a.go":      "package x\n",
+				"x/b.go":      "package x\n",
+				"x/b_test.go": "package x_test\n",
+				"y/c.go":      "package y\n",
+			},
+			opts: Options{SplitBy: "count", FilesPerBranch: 4, GroupByPackage: true},
+			want: map[string][]string{
+				"split-1": {"x/a.go", "x/b.go", "x/b_test.go", "y/c.go"},
+				"split-2": {"notes.txt"},
+			},
+		},
+		{
+			name: "package larger than a group",
+			diff: diffOf("x/a.go", "x/b.go", "x/c.go", "y/d.go"),
+			tree: fakeTree{
+				"x/a.go": "package x\n",
+				"x/b.go": "package x\n",
+				"x/c.go": "package x\n",
+				"y/d.go": "package y\n",
+			},
+			opts: Options{SplitBy: "count", FilesPerBranch: 2, GroupByPackage: true},
+			want: map[string][]string{
+				"split-1": {"x/a.go", "x/b.go"},
+				"split-2": {"x/c.go"},
+				"split-3": {"y/d.go"},
+			},
+		},
+		{
+			name: "keep tests together",
+			diff: diffOf("a.go", "b.go", "c.go", "a_test.go", "test_d.py", "d.py"),
+			opts: Options{SplitBy: "count", FilesPerBranch: 2, KeepTestsTogether: true, TestPatterns: DefaultTestPatterns},
+			want: map[string][]string{
+				"split-1": {"a.go", "a_test.go"},
+				"split-2": {"b.go", "c.go"},
+				"split-3": {"test_d.py", "d.py"},
+			},
+		},
+		{
+			name: "keep tests together by size",
+			diff: []DiffFile{
+				{Name: "a.go", Lines: 10},
+				{Name: "a_test.go", Lines: 50},
+				{Name: "b.go", Lines: 40},
+			},
+			opts: Options{SplitBy: "size", NumBranches: 2, KeepTestsTogether: true, TestPatterns: DefaultTestPatterns},
+			want: map[string][]string{
+				"split-1": {"a.go", "a_test.go"},
+				"split-2": {"b.go"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.BranchName = testBranchName
+			cfg, err := Generate(tt.diff, tt.tree, tt.opts)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if got := groupFiles(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Generate groups = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateBranchNameError(t *testing.T) {
+	opts := Options{
+		SplitBy:        "count",
+		FilesPerBranch: 1,
+		BranchName: func(index int, key string) (string, error) {
+			return "", fmt.Errorf("no name for group %d", index)
+		},
+	}
+	if _, err := Generate(diffOf("a.go"), nil, opts); err == nil {
+		t.Fatal("Generate succeeded despite a failing BranchName")
+	}
+}
+
+func TestCapBranchGroups(t *testing.T) {
+	cfg := SplitConfig{Branches: []BranchGroup{
+		{Name: "split-1", Files: []string{"a"}},
+		{Name: "split-2", Files: []string{"b"}},
+		{Name: "split-3", Files: []string{"c"}},
+		{Name: "split-4", Files: []string{"d", "e"}},
+	}}
+
+	tests := []struct {
+		name     string
+		max      int
+		overflow string
+		want     []BranchGroup
+	}{
+		{
+			name:     "no limit",
+			max:      0,
+			overflow: "pack",
+			want:     cfg.Branches,
+		},
+		{
+			name:     "under the limit",
+			max:      4,
+			overflow: "drop",
+			want:     cfg.Branches,
+		},
+		{
+			name:     "pack",
+			max:      2,
+			overflow: "pack",
+			want: []BranchGroup{
+				{Name: "split-1", Files: []string{"a"}},
+				{Name: "split-2", Files: []string{"b", "c", "d", "e"}},
+			},
+		},
+		{
+			name:     "keep",
+			max:      2,
+			overflow: "keep",
+			want: []BranchGroup{
+				{Name: "split-1", Files: []string{"a"}},
+				{Name: "split-2", Files: []string{"b"}},
+				{Name: KeepGroupName, Files: []string{"c", "d", "e"}},
+			},
+		},
+		{
+			name:     "drop",
+			max:      3,
+			overflow: "drop",
+			want: []BranchGroup{
+				{Name: "split-1", Files: []string{"a"}},
+				{Name: "split-2", Files: []string{"b"}},
+				{Name: "split-3", Files: []string{"c"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CapBranchGroups(cfg, tt.max, tt.overflow)
+			if !reflect.DeepEqual(got.Branches, tt.want) {
+				t.Errorf("CapBranchGroups = %v, want %v", got.Branches, tt.want)
+			}
+		})
+	}
+	if got := cfg.Branches[1].Files; !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("pack modified the files of the input group: %v", got)
+	}
+}
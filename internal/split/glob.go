@@ -0,0 +1,89 @@
+package split
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+func MatchAnyGlob(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether a slash-separated repository path matches pattern.
+// Each path segment is matched with path.Match, and a "**" segment matches any
+// number of directories. A pattern without a slash is matched against the
+// file's base name, so "*.lock" matches lock files in any directory.
+func MatchGlob(pattern, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(file))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+// ExpandFilePatterns replaces the glob patterns in the file lists of cfg with
+// the diff files they match, in diff order, skipping files the group already
+// lists. Entries naming a diff file are kept even if they contain glob
+// characters.
+func ExpandFilePatterns(cfg SplitConfig, diffFiles []string) (SplitConfig, error) {
+	isDiffFile := make(map[string]bool, len(diffFiles))
+	for _, file := range diffFiles {
+		isDiffFile[file] = true
+	}
+	for i, group := range cfg.Branches {
+		var files []string
+		seen := make(map[string]bool)
+		for _, entry := range group.Files {
+			if isDiffFile[entry] || !strings.ContainsAny(entry, "*?[") {
+				seen[entry] = true
+				files = append(files, entry)
+				continue
+			}
+			if _, err := path.Match(entry, ""); err != nil {
+				return cfg, fmt.Errorf("invalid glob pattern '%s' in branch '%s': %v", entry, group.Name, err)
+			}
+			matched := false
+			for _, file := range diffFiles {
+				if MatchGlob(entry, file) {
+					matched = true
+					if !seen[file] {
+						seen[file] = true
+						files = append(files, file)
+					}
+				}
+			}
+			if !matched {
+				return cfg, fmt.Errorf("pattern '%s' in branch '%s' matches no diff file", entry, group.Name)
+			}
+		}
+		cfg.Branches[i].Files = files
+	}
+	return cfg, nil
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
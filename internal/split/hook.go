@@ -0,0 +1,33 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// runPostBranchHook runs command (--post-branch-hook) through the shell with
+// the branch that was just committed checked out. The committed files are
+// passed in SPLIT_FILES, one per line, and the 1-based position of the branch
+// in SPLIT_INDEX.
+func runPostBranchHook(ctx context.Context, command, branch string, index int, files []string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"SPLIT_BRANCH="+branch,
+		"SPLIT_FILES="+strings.Join(files, "\n"),
+		"SPLIT_INDEX="+strconv.Itoa(index),
+	)
+	// Keep stdout free for --output json
+	cmd.Stdout = LogOut
+	cmd.Stderr = LogOut
+	if err := cmd.Run(); err != nil {
+		if stopped := interrupted(ctx); stopped != nil {
+			return stopped
+		}
+		return fmt.Errorf("post-branch hook failed on branch '%s': %v", branch, err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package split
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// FileHunks is the line diff of a modified file between the commit the split
+// branches start from and the source branch. A hunk is a run of consecutive changed lines; hunks are
+// numbered from 1 in file order.
+type FileHunks struct {
+	diffs []diffmatchpatch.Diff
+	// hunk number of each diff, 0 for unchanged text
+	hunkOf []int
+	count  int
+}
+
+// LoadFileHunks returns the hunks of file, which must be a text file modified
+// between the start and source trees.
+func LoadFileHunks(startTree, sourceTree *object.Tree, file string) (*FileHunks, error) {
+	startFile, err := startTree.File(file)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' can only be split by hunk when it is modified, not added or deleted", file)
+	}
+	sourceFile, err := sourceTree.File(file)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' can only be split by hunk when it is modified, not added or deleted", file)
+	}
+	for _, f := range []*object.File{startFile, sourceFile} {
+		if binary, err := f.IsBinary(); err != nil || binary {
+			return nil, fmt.Errorf("'%s' is binary and cannot be split by hunk", file)
+		}
+	}
+	startText, err := startFile.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s' from the start commit: %v", file, err)
+	}
+	sourceText, err := sourceFile.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s' from the source: %v", file, err)
+	}
+
+	h := &FileHunks{diffs: diff.Do(startText, sourceText)}
+	h.hunkOf = make([]int, len(h.diffs))
+	inHunk := false
+	for i, d := range h.diffs {
+		if d.Type == diffmatchpatch.DiffEqual {
+			inHunk = false
+			continue
+		}
+		if !inHunk {
+			h.count++
+			inHunk = true
+		}
+		h.hunkOf[i] = h.count
+	}
+	return h, nil
+}
+
+// apply returns the start content with only the selected hunks applied.
+func (h *FileHunks) apply(selected map[int]bool) []byte {
+	var b strings.Builder
+	for i, d := range h.diffs {
+		switch {
+		case d.Type == diffmatchpatch.DiffEqual,
+			d.Type == diffmatchpatch.DiffInsert && selected[h.hunkOf[i]],
+			d.Type == diffmatchpatch.DiffDelete && !selected[h.hunkOf[i]]:
+			b.WriteString(d.Text)
+		}
+	}
+	return []byte(b.String())
+}
+
+// Headers returns a unified diff style "@@ -l,n +l,n @@" header per hunk so
+// that hunk numbers can be matched with the changes.
+func (h *FileHunks) Headers() []string {
+	headers := make([]string, h.count)
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(h.diffs); {
+		d := h.diffs[i]
+		if d.Type == diffmatchpatch.DiffEqual {
+			lines := countLines(d.Text)
+			oldLine += lines
+			newLine += lines
+			i++
+			continue
+		}
+		hunk := h.hunkOf[i]
+		oldStart, newStart := oldLine, newLine
+		for ; i < len(h.diffs) && h.hunkOf[i] == hunk; i++ {
+			if h.diffs[i].Type == diffmatchpatch.DiffDelete {
+				oldLine += countLines(h.diffs[i].Text)
+			} else {
+				newLine += countLines(h.diffs[i].Text)
+			}
+		}
+		headers[hunk-1] = fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, oldLine-oldStart, newStart, newLine-newStart)
+	}
+	return headers
+}
+
+func countLines(text string) int {
+	lines := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		lines++
+	}
+	return lines
+}
+
+// LoadSplitHunks checks the hunks of the split config against the diff: every
+// file with hunks must be a modified text file listed in its group, hunk
+// numbers must exist, and no hunk may go to two groups. It returns the hunks
+// of every such file and warns about hunks left out of every group. Groups
+// may only select hunks when enabled (--split-hunks) is set.
+func LoadSplitHunks(cfg SplitConfig, startTree, sourceTree *object.Tree, enabled bool) (map[string]*FileHunks, error) {
+	hunks := make(map[string]*FileHunks)
+	owner := make(map[string]map[int]string)
+	var files []string
+	for _, group := range cfg.Branches {
+		if len(group.Hunks) > 0 && !enabled {
+			return nil, fmt.Errorf("branch '%s' selects hunks, which requires --split-hunks", group.Name)
+		}
+		listed := make(map[string]bool)
+		for _, file := range group.Files {
+			listed[file] = true
+		}
+		for file, numbers := range group.Hunks {
+			if !listed[file] {
+				return nil, fmt.Errorf("branch '%s' selects hunks of '%s', which is not in its files", group.Name, file)
+			}
+			h, ok := hunks[file]
+			if !ok {
+				var err error
+				if h, err = LoadFileHunks(startTree, sourceTree, file); err != nil {
+					return nil, err
+				}
+				hunks[file] = h
+				owner[file] = make(map[int]string)
+				files = append(files, file)
+			}
+			for _, n := range numbers {
+				if n < 1 || n > h.count {
+					return nil, fmt.Errorf("branch '%s' selects hunk %d of '%s', which has %d hunk(s)", group.Name, n, file, h.count)
+				}
+				if other, taken := owner[file][n]; taken && other != group.Name {
+					return nil, fmt.Errorf("hunk %d of '%s' is selected by both '%s' and '%s'", n, file, other, group.Name)
+				}
+				owner[file][n] = group.Name
+			}
+		}
+	}
+
+	sort.Strings(files)
+	for _, file := range files {
+		var left []string
+		for n := 1; n <= hunks[file].count; n++ {
+			if _, ok := owner[file][n]; !ok {
+				left = append(left, fmt.Sprint(n))
+			}
+		}
+		if len(left) > 0 {
+			Infof("Warning: hunk(s) %s of '%s' are not assigned to any branch\n", strings.Join(left, ", "), file)
+		}
+	}
+	return hunks, nil
+}
+
+// hunkSplitFiles returns the files of cfg whose hunks are selected in every
+// group that lists them; they may appear in more than one group.
+func hunkSplitFiles(cfg SplitConfig) map[string]bool {
+	split := make(map[string]bool)
+	whole := make(map[string]bool)
+	for _, group := range cfg.Branches {
+		for _, file := range group.Files {
+			if len(group.Hunks[file]) > 0 {
+				split[file] = true
+			} else {
+				whole[file] = true
+			}
+		}
+	}
+	for file := range whole {
+		delete(split, file)
+	}
+	return split
+}
+
+// storeBlob writes data to the object database and returns its hash.
+func storeBlob(repo *git.Repository, data []byte) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(data)))
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
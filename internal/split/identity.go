@@ -0,0 +1,95 @@
+package split
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitSignatures builds the author and committer of the split commits. The
+// committer comes from GIT_COMMITTER_NAME/GIT_COMMITTER_EMAIL or the
+// user.name and user.email settings of the repository and global config; the
+// author defaults to the committer and can be overridden by
+// GIT_AUTHOR_NAME/GIT_AUTHOR_EMAIL and then override (--author).
+func commitSignatures(repo *git.Repository, override object.Signature) (author, committer *object.Signature, err error) {
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read git config: %v", err)
+	}
+	committer = &object.Signature{
+		Name:  envOr("GIT_COMMITTER_NAME", cfg.User.Name),
+		Email: envOr("GIT_COMMITTER_EMAIL", cfg.User.Email),
+	}
+	if committer.Name == "" || committer.Email == "" {
+		return nil, nil, fmt.Errorf("user.name and user.email must be set in git config to create commits")
+	}
+	author = &object.Signature{
+		Name:  envOr("GIT_AUTHOR_NAME", committer.Name),
+		Email: envOr("GIT_AUTHOR_EMAIL", committer.Email),
+	}
+	if override.Name != "" {
+		author.Name, author.Email = override.Name, override.Email
+	}
+	return author, committer, nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// ParseAuthor parses an identity in the "Name <email>" form used by git.
+func ParseAuthor(value string) (object.Signature, error) {
+	open := strings.Index(value, "<")
+	if open < 0 || !strings.HasSuffix(value, ">") || strings.Count(value, "<") != 1 || strings.Count(value, ">") != 1 {
+		return object.Signature{}, fmt.Errorf("invalid --author value '%s' (expected 'Name <email>')", value)
+	}
+	name := strings.TrimSpace(value[:open])
+	email := strings.TrimSpace(value[open+1 : len(value)-1])
+	if name == "" || email == "" {
+		return object.Signature{}, fmt.Errorf("invalid --author value '%s' (expected 'Name <email>')", value)
+	}
+	return object.Signature{Name: name, Email: email}, nil
+}
+
+var commitDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+}
+
+// ParseCommitDate accepts ISO 8601 and RFC 2822 dates as well as git's
+// internal "<unix timestamp> <offset>" format. Dates without a time zone are
+// taken as local time.
+func ParseCommitDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range commitDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	fields := strings.Fields(strings.TrimPrefix(value, "@"))
+	if len(fields) >= 1 && len(fields) <= 2 {
+		if sec, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			t := time.Unix(sec, 0)
+			if len(fields) == 1 {
+				return t, nil
+			}
+			if zone, err := time.Parse("-0700", fields[1]); err == nil {
+				return t.In(zone.Location()), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a date like 2024-01-31T12:00:00+09:00")
+}
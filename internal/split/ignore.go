@@ -0,0 +1,24 @@
+package split
+
+import (
+	"fmt"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// loadIgnore reads the .gitignore files and info/exclude of the checked out
+// worktree, together with the worktree's own Excludes.
+func loadIgnore(worktree *git.Worktree) (gitignore.Matcher, error) {
+	patterns, err := gitignore.ReadPatterns(worktree.Filesystem, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitignore: %v", err)
+	}
+	patterns = append(patterns, worktree.Excludes...)
+	return gitignore.NewMatcher(patterns), nil
+}
+
+func isIgnored(matcher gitignore.Matcher, file string) bool {
+	return matcher.Match(strings.Split(file, "/"), false)
+}
@@ -0,0 +1,19 @@
+package split
+
+import (
+	"context"
+	"fmt"
+)
+
+// interrupted returns the error for a split stopped by ctx, or nil while ctx
+// is still running. The cause given to ctx, such as the --timeout that was
+// reached, is kept in the message.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+		return fmt.Errorf("%w: %v", ErrInterrupted, cause)
+	}
+	return ErrInterrupted
+}
@@ -0,0 +1,41 @@
+package split
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+// fileFilter returns the filter attribute of file, such as "lfs" for files
+// tracked by Git LFS, or an empty string when it has none.
+func fileFilter(matcher gitattributes.Matcher, file string) string {
+	attrs, _ := matcher.Match(strings.Split(file, "/"), []string{"filter"})
+	if attr, ok := attrs["filter"]; ok && attr.IsValueSet() {
+		return attr.Value()
+	}
+	return ""
+}
+
+// smudgeFile runs the smudge command configured for filter on the content of
+// file as stored in git, the way a checkout by git would. go-git has no
+// support for filters, so the command comes from git config.
+func smudgeFile(filter, file string, data []byte) ([]byte, error) {
+	out, err := exec.Command("git", "config", "--get", "filter."+filter+".smudge").Output()
+	command := strings.TrimSpace(string(out))
+	if err != nil || command == "" {
+		return nil, fmt.Errorf("cannot smudge '%s': no filter.%s.smudge command is configured", file, filter)
+	}
+	// %f is the path of the file, passed as an argument instead of quoted
+	cmd := exec.Command("sh", "-c", strings.ReplaceAll(command, "%f", `"$1"`), "sh", file)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	smudged, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to smudge '%s' with the '%s' filter: %v: %s", file, filter, err, strings.TrimSpace(stderr.String()))
+	}
+	return smudged, nil
+}
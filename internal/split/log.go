@@ -0,0 +1,44 @@
+package split
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Verbosity levels selected with --quiet and --verbose
+type Level int
+
+const (
+	LevelQuiet Level = iota
+	LevelInfo
+	LevelVerbose
+)
+
+var (
+	Verbosity = LevelInfo
+
+	// Destination for all diagnostic messages
+	LogOut io.Writer = os.Stderr
+)
+
+// Infof prints key milestones and warnings, suppressed by --quiet.
+func Infof(format string, args ...interface{}) {
+	logf(LevelInfo, format, args...)
+}
+
+// Verbosef prints per-file details and timings, shown only with --verbose.
+func Verbosef(format string, args ...interface{}) {
+	logf(LevelVerbose, format, args...)
+}
+
+func logf(level Level, format string, args ...interface{}) {
+	if Verbosity < level {
+		return
+	}
+	if p := activeProgress; p != nil && p.drawn {
+		p.clear()
+		defer p.draw()
+	}
+	fmt.Fprintf(LogOut, format, args...)
+}
@@ -0,0 +1,43 @@
+package split
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	git "github.com/go-git/go-git/v5"
+	"gopkg.in/yaml.v2"
+)
+
+// splitManifest is written into each split branch with --manifest so that
+// reviewers can see where the branch came from.
+type splitManifest struct {
+	Branch string   `yaml:"branch"`
+	Source string   `yaml:"source"`
+	Base   string   `yaml:"base"`
+	Files  []string `yaml:"files"`
+}
+
+// writeManifest writes the manifest of group to manifestFile in the worktree
+// and stages it.
+func writeManifest(worktree *git.Worktree, group BranchGroup, manifestFile string, rng Range) error {
+	data, err := yaml.Marshal(splitManifest{
+		Branch: group.Name,
+		Source: rng.Source,
+		Base:   rng.Base,
+		Files:  group.Files,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(manifestFile), 0755); err != nil {
+		return fmt.Errorf("failed to create directory '%s': %v", filepath.Dir(manifestFile), err)
+	}
+	if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest '%s': %v", manifestFile, err)
+	}
+	if _, err := worktree.Add(manifestFile); err != nil {
+		return fmt.Errorf("failed to add manifest '%s' to staging: %v", manifestFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package split
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// MessageOptions selects how CommitMessage writes the commit message of a
+// group. The fields mirror --commit-msg-mode, --commit-template and --message.
+type MessageOptions struct {
+	// files, latest, first-line or template
+	Mode     string
+	Template *template.Template
+	// Parsed from --message or --message-file; overrides Mode
+	Fixed *template.Template
+	// Read by the latest, first-line and template modes
+	Logs *CommitLogs
+}
+
+// Variables available to --commit-template
+type commitTemplateData struct {
+	BranchName string
+	Files      []string
+	Logs       []string
+}
+
+func LoadCommitTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit template '%s': %v", path, err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse commit template '%s': %v", path, err)
+	}
+	return tmpl, nil
+}
+
+func renderCommitTemplate(group BranchGroup, opts MessageOptions) (string, error) {
+	seen := make(map[string]bool)
+	logs := []string{}
+	for _, file := range group.Files {
+		fileLogs, err := opts.Logs.Subjects(file)
+		if err != nil {
+			return "", err
+		}
+		for _, subject := range fileLogs {
+			if !seen[subject] {
+				seen[subject] = true
+				logs = append(logs, subject)
+			}
+		}
+	}
+
+	var buf strings.Builder
+	data := commitTemplateData{BranchName: group.Name, Files: group.Files, Logs: logs}
+	if err := opts.Template.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render commit template for branch '%s': %v", group.Name, err)
+	}
+	msg := strings.TrimSpace(buf.String())
+	if msg == "" {
+		return "", fmt.Errorf("commit template rendered an empty message for branch '%s'", group.Name)
+	}
+	return msg, nil
+}
+
+// LoadFixedMessage parses the message given with --message, or read from
+// file with --message-file.
+func LoadFixedMessage(text, file string) (*template.Template, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message file '%s': %v", file, err)
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("the commit message is empty")
+	}
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse commit message: %v", err)
+	}
+	return tmpl, nil
+}
+
+// renderFixedMessage renders the message of --message for group; the commit
+// logs are never read, so {{.Logs}} is empty.
+func renderFixedMessage(tmpl *template.Template, group BranchGroup) (string, error) {
+	var buf strings.Builder
+	data := commitTemplateData{BranchName: group.Name, Files: group.Files, Logs: []string{}}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render commit message for branch '%s': %v", group.Name, err)
+	}
+	msg := strings.TrimSpace(buf.String())
+	if msg == "" {
+		return "", fmt.Errorf("commit message rendered empty for branch '%s'", group.Name)
+	}
+	return msg, nil
+}
+
+func CommitMessage(group BranchGroup, opts MessageOptions) (string, error) {
+	if opts.Fixed != nil {
+		return renderFixedMessage(opts.Fixed, group)
+	}
+	filesMsg := fmt.Sprintf("Update diff files: %v", group.Files)
+	switch opts.Mode {
+	case "files":
+		return filesMsg, nil
+	case "template":
+		return renderCommitTemplate(group, opts)
+	}
+
+	// Newest subject per file, de-duplicated across the group
+	seen := make(map[string]bool)
+	var subjects []string
+	for _, file := range group.Files {
+		logs, err := opts.Logs.Subjects(file)
+		if err != nil {
+			return "", err
+		}
+		if len(logs) == 0 || seen[logs[0]] {
+			continue
+		}
+		seen[logs[0]] = true
+		subjects = append(subjects, logs[0])
+	}
+	if len(subjects) == 0 {
+		return filesMsg, nil
+	}
+	if opts.Mode == "first-line" {
+		return strings.Join(subjects, "; "), nil
+	}
+	return strings.Join(subjects, "\n"), nil
+}
+
+// PrintDryRun writes the branches of cfg with their files and commit messages
+// to w instead of creating them.
+func PrintDryRun(w io.Writer, cfg SplitConfig, opts MessageOptions) error {
+	fmt.Fprintln(w, "\nDry run: no branches were created and the repository was not changed.")
+	for _, group := range cfg.Branches {
+		if len(group.Files) == 0 {
+			fmt.Fprintf(w, "Skipping branch '%s' as there are no target files.\n", group.Name)
+			continue
+		}
+		fmt.Fprintf(w, "==> Branch '%s' (number of target files: %d)\n", group.Name, len(group.Files))
+		for _, file := range group.Files {
+			fmt.Fprintf(w, "- %s\n", file)
+		}
+		msg, err := CommitMessage(group, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Commit message: %s\n", msg)
+	}
+	return nil
+}
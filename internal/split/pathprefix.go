@@ -0,0 +1,35 @@
+package split
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CleanPathPrefixes normalizes the --path prefixes to clean paths relative to
+// the repository root, such as "services/api". A prefix naming the root
+// itself lifts the restriction.
+func CleanPathPrefixes(prefixes []string) ([]string, error) {
+	var cleaned []string
+	for _, prefix := range prefixes {
+		clean := path.Clean(strings.ReplaceAll(prefix, "\\", "/"))
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("--path '%s' must be a path inside the repository, relative to its root", prefix)
+		}
+		if clean == "." {
+			return nil, nil
+		}
+		cleaned = append(cleaned, clean)
+	}
+	return cleaned, nil
+}
+
+// underPathPrefix reports whether file is one of prefixes or lies below one.
+func underPathPrefix(prefixes []string, file string) bool {
+	for _, prefix := range prefixes {
+		if file == prefix || strings.HasPrefix(file, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package split
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// sourceBlob is the content of a split file, read from the source tree
+// before the serial checkout and commit phase.
+type sourceBlob struct {
+	Data []byte
+	Mode filemode.FileMode
+	Hash plumbing.Hash
+}
+
+// prefetchSplit reads the source content of every file in cfg and renders the
+// commit message of every group using up to opts.Jobs workers. Files that do not
+// exist in the source tree have no entry in the returned map.
+//
+// go-git repositories are not safe for concurrent use, so with more than one
+// job every worker opens the repository on its own.
+func prefetchSplit(sourceTree *object.Tree, cfg SplitConfig, opts BranchOptions) (map[string]*sourceBlob, []string, error) {
+	jobs := opts.Jobs
+	var files []string
+	seen := make(map[string]bool)
+	for _, group := range cfg.Branches {
+		for _, file := range group.Files {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	blobs := make(map[string]*sourceBlob)
+	messages := make([]string, len(cfg.Branches))
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	// Tasks are file indexes followed by group indexes
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tree := sourceTree
+			if jobs > 1 {
+				repo, err := git.PlainOpen(".")
+				if err == nil {
+					tree, err = repo.TreeObject(sourceTree.Hash)
+				}
+				if err != nil {
+					fail(fmt.Errorf("failed to open repository: %v", err))
+					for range tasks {
+					}
+					return
+				}
+			}
+			for task := range tasks {
+				if task < len(files) {
+					blob, err := readSourceBlob(tree, files[task], opts.FilePerm)
+					if err != nil {
+						fail(err)
+						continue
+					}
+					if blob != nil {
+						mu.Lock()
+						blobs[files[task]] = blob
+						mu.Unlock()
+					}
+					continue
+				}
+				group := task - len(files)
+				if len(cfg.Branches[group].Files) == 0 {
+					continue
+				}
+				msg, err := CommitMessage(cfg.Branches[group], opts.Messages)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				messages[group] = msg
+			}
+		}()
+	}
+	for task := 0; task < len(files)+len(cfg.Branches); task++ {
+		tasks <- task
+	}
+	close(tasks)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return blobs, messages, nil
+}
+
+// readSourceBlob returns the content of file in tree, or nil when the file
+// does not exist there.
+func readSourceBlob(tree *object.Tree, file string, filePerm os.FileMode) (*sourceBlob, error) {
+	fileContent, err := tree.File(file)
+	if err == object.ErrFileNotFound {
+		// Submodules have no blob, only the commit they point to
+		if entry, err := tree.FindEntry(file); err == nil && entry.Mode == filemode.Submodule {
+			return &sourceBlob{Mode: filemode.Submodule, Hash: entry.Hash}, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file '%s' from source tree: %v", file, err)
+	}
+
+	fileReader, err := fileContent.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reader for file '%s': %v", file, err)
+	}
+	defer fileReader.Close()
+
+	fileData, err := io.ReadAll(fileReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file '%s': %v", file, err)
+	}
+	return &sourceBlob{Data: fileData, Mode: gitFileMode(fileContent.Mode, filePerm), Hash: fileContent.Hash}, nil
+}
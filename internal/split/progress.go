@@ -0,0 +1,88 @@
+package split
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const progressWidth = 30
+
+// progressBar is the live bar of --progress. While it is drawn, logf clears it
+// before printing and draws it again afterwards so that log lines don't end up
+// on the bar's line. On a non-terminal stderr it prints a line per update
+// instead.
+type progressBar struct {
+	total int
+	done  int
+	start time.Time
+	tty   bool
+	drawn bool
+}
+
+// Bar drawn at the bottom of the log output, if any
+var activeProgress *progressBar
+
+func startProgress(total int, show bool) *progressBar {
+	if !show || Verbosity < LevelInfo || total == 0 {
+		return nil
+	}
+	p := &progressBar{total: total, start: time.Now(), tty: LogOut == os.Stderr && term.IsTerminal(int(os.Stderr.Fd()))}
+	activeProgress = p
+	p.draw()
+	return p
+}
+
+// update records that done branches are finished.
+func (p *progressBar) update(done int) {
+	if p == nil {
+		return
+	}
+	p.done = done
+	if p.tty {
+		p.clear()
+		p.draw()
+	} else {
+		fmt.Fprintln(LogOut, p.line())
+	}
+}
+
+// stop leaves the last state of the bar on its own line.
+func (p *progressBar) stop() {
+	if p == nil || activeProgress != p {
+		return
+	}
+	if p.drawn {
+		fmt.Fprintln(LogOut)
+		p.drawn = false
+	}
+	activeProgress = nil
+}
+
+func (p *progressBar) clear() {
+	if p.drawn {
+		fmt.Fprint(LogOut, "\r\x1b[K")
+		p.drawn = false
+	}
+}
+
+func (p *progressBar) draw() {
+	if p.tty && !p.drawn {
+		fmt.Fprint(LogOut, p.line())
+		p.drawn = true
+	}
+}
+
+func (p *progressBar) line() string {
+	filled := progressWidth * p.done / p.total
+	line := fmt.Sprintf("[%s%s] %d/%d %3d%%", strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), p.done, p.total, 100*p.done/p.total)
+	if p.done > 0 && p.done < p.total {
+		perBranch := time.Since(p.start) / time.Duration(p.done)
+		eta := perBranch * time.Duration(p.total-p.done)
+		line += fmt.Sprintf(" ETA %v", eta.Round(time.Second))
+	}
+	return line
+}
@@ -0,0 +1,215 @@
+package split
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Range names the base and source of a split as given on the command line.
+// The commit logs read base..source, and the trailers and the manifest
+// record both names.
+type Range struct {
+	Base   string
+	Source string
+}
+
+// IsBareRepository reports whether repo has no working tree of its own.
+func IsBareRepository(repo *git.Repository) bool {
+	_, err := repo.Worktree()
+	return err == git.ErrIsBareRepository
+}
+
+// CheckCleanWorktree lists the uncommitted changes of the worktree and
+// returns an error matching ErrDirtyWorktree when there are any.
+func CheckCleanWorktree(repo *git.Repository) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %v", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree status: %v", err)
+	}
+	if status.IsClean() {
+		return nil
+	}
+
+	var staged, unstaged, untracked []string
+	for file, fileStatus := range status {
+		if fileStatus.Worktree == git.Untracked {
+			untracked = append(untracked, file)
+			continue
+		}
+		if fileStatus.Staging != git.Unmodified {
+			staged = append(staged, file)
+		}
+		if fileStatus.Worktree != git.Unmodified {
+			unstaged = append(unstaged, file)
+		}
+	}
+
+	fmt.Fprintln(LogOut, "\nThe working tree has uncommitted changes:")
+	for _, list := range []struct {
+		label string
+		files []string
+	}{
+		{"Staged", staged},
+		{"Unstaged", unstaged},
+		{"Untracked", untracked},
+	} {
+		if len(list.files) == 0 {
+			continue
+		}
+		sort.Strings(list.files)
+		fmt.Fprintf(LogOut, "%s files:\n", list.label)
+		for _, file := range list.files {
+			fmt.Fprintf(LogOut, "- %s\n", file)
+		}
+	}
+	return fmt.Errorf("%w; commit or stash your changes, or pass --allow-dirty", ErrDirtyWorktree)
+}
+
+// DetectDefaultBranch returns the branch that refs/remotes/origin/HEAD points
+// to, preferring the local branch of the same name when it exists.
+func DetectDefaultBranch(repo *git.Repository) (string, bool) {
+	ref, err := repo.Reference(plumbing.NewRemoteHEADReferenceName("origin"), false)
+	if err != nil || ref.Type() != plumbing.SymbolicReference {
+		return "", false
+	}
+	remoteBranch := ref.Target().Short() // e.g. origin/develop
+	name := strings.TrimPrefix(remoteBranch, "origin/")
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName(name), true); err == nil {
+		return name, true
+	}
+	if _, err := repo.Reference(ref.Target(), true); err == nil {
+		return remoteBranch, true
+	}
+	return "", false
+}
+
+// CommitAndTree returns the commit of revision (see ResolveRevision) and its
+// tree. A revision that does not exist is reported as ErrBranchNotFound.
+func CommitAndTree(repo *git.Repository, revision string) (*object.Commit, *object.Tree, error) {
+	Verbosef("Getting reference for '%s'...\n", revision)
+	hash, kind, err := ResolveRevision(repo, revision)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil, nil, fmt.Errorf("failed to resolve '%s': %w", revision, ErrBranchNotFound)
+		}
+		return nil, nil, fmt.Errorf("failed to resolve '%s' as a branch, tag or revision: %v", revision, err)
+	}
+	Verbosef("Successfully got reference for %s '%s'\n", kind, revision)
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get commit for '%s': %v", revision, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tree for '%s': %v", revision, err)
+	}
+	return commit, tree, nil
+}
+
+// StartCommit returns the commit the split branches are created from: the
+// from revision, or else the merge-base of the base and source commits so
+// that the branches don't carry base-branch changes the source never saw.
+func StartCommit(repo *git.Repository, rng Range, from string, baseCommit, sourceCommit *object.Commit) (*object.Commit, error) {
+	if from != "" {
+		hash, _, err := ResolveRevision(repo, from)
+		if err != nil {
+			return nil, err
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commit for '%s': %v", from, err)
+		}
+		Infof("Creating the split branches from '%s' (%s)\n", from, ShortHash(commit.Hash.String()))
+		return commit, nil
+	}
+
+	base, err := MergeBase(baseCommit, sourceCommit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the merge-base: %v", err)
+	}
+	if base == nil {
+		Infof("Warning: '%s' and '%s' have no common ancestor; creating the split branches from the base branch.\n", rng.Base, rng.Source)
+		return baseCommit, nil
+	}
+	if base.Hash != baseCommit.Hash {
+		Infof("Creating the split branches from the merge-base of '%s' and '%s' (%s)\n", rng.Base, rng.Source, ShortHash(base.Hash.String()))
+	}
+	return base, nil
+}
+
+// MergeBase returns the best common ancestor of the two commits, or nil when
+// their histories are unrelated.
+func MergeBase(baseCommit, sourceCommit *object.Commit) (*object.Commit, error) {
+	bases, err := baseCommit.MergeBase(sourceCommit)
+	if err != nil || len(bases) == 0 {
+		return nil, err
+	}
+	return bases[0], nil
+}
+
+// ResolveRevision looks up revision as a branch, then a tag, then any
+// revision understood by go-git (e.g. HEAD~3 or a short SHA). It returns the
+// commit hash and a description of what the revision was resolved as.
+func ResolveRevision(repo *git.Repository, revision string) (plumbing.Hash, string, error) {
+	if ref, err := repo.Reference(plumbing.NewBranchReferenceName(revision), true); err == nil {
+		return ref.Hash(), "branch", nil
+	}
+	if ref, err := repo.Reference(plumbing.NewTagReferenceName(revision), true); err == nil {
+		// Annotated tags point to a tag object rather than the commit itself
+		if tag, err := repo.TagObject(ref.Hash()); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return plumbing.ZeroHash, "", fmt.Errorf("tag '%s' does not point to a commit: %v", revision, err)
+			}
+			return commit.Hash, "tag", nil
+		}
+		return ref.Hash(), "tag", nil
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+	return *hash, "revision", nil
+}
+
+// HeadName names what headRef points to: its branch, or its commit hash when
+// HEAD is detached.
+func HeadName(headRef *plumbing.Reference) string {
+	if headRef.Name().IsBranch() {
+		return headRef.Name().Short()
+	}
+	return headRef.Hash().String()
+}
+
+func DescribeHead(headRef *plumbing.Reference) string {
+	if headRef.Name().IsBranch() {
+		return fmt.Sprintf("branch '%s'", headRef.Name().Short())
+	}
+	return fmt.Sprintf("detached HEAD at %s", ShortHash(headRef.Hash().String()))
+}
+
+// originalCheckout returns the options that check out headRef again, by
+// commit when HEAD was detached.
+func originalCheckout(headRef *plumbing.Reference, force bool) *git.CheckoutOptions {
+	if headRef.Name().IsBranch() {
+		return &git.CheckoutOptions{Branch: headRef.Name(), Force: force}
+	}
+	return &git.CheckoutOptions{Hash: headRef.Hash(), Force: force}
+}
+
+func ShortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -0,0 +1,64 @@
+package split
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// residualFiles returns the files that status shows as changed but that were
+// neither committed (or stashed) as staged nor are a line-ending conversion of
+// a committed file. Left alone they would block the next checkout.
+func residualFiles(status git.Status, staged, converted []string) []string {
+	handled := make(map[string]bool)
+	for _, file := range append(append([]string{}, staged...), converted...) {
+		handled[file] = true
+	}
+	var residue []string
+	for file, fileStatus := range status {
+		if handled[file] || fileStatus.Staging == git.Untracked {
+			continue
+		}
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			residue = append(residue, file)
+		}
+	}
+	sort.Strings(residue)
+	return residue
+}
+
+// handleResidue deals with the residual files of branch according to mode
+// (--on-residue) before the next branch is checked out. With commit it returns
+// the hash of the commit holding them, otherwise the zero hash.
+func handleResidue(worktree *git.Worktree, branch string, residue []string, mode string, opts *git.CommitOptions) (plumbing.Hash, error) {
+	if len(residue) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+	switch mode {
+	case "commit":
+		for _, file := range residue {
+			if _, err := worktree.Add(file); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("failed to stage residual file '%s': %v", file, err)
+			}
+		}
+		hash, err := worktree.Commit("Add residual changes: "+strings.Join(residue, ", "), opts)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to commit residual changes in branch '%s': %v", branch, err)
+		}
+		Infof("Committed residual changes to branch '%s': %s\n", branch, strings.Join(residue, ", "))
+		return hash, nil
+	case "stash":
+		args := append([]string{"stash", "push", "-m", stashMessagePrefix + branch + " (residue)", "--"}, residue...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to stash residual changes of branch '%s': %v: %s", branch, err, strings.TrimSpace(string(out)))
+		}
+		Infof("Stashed residual changes of branch '%s': %s\n", branch, strings.Join(residue, ", "))
+	default:
+		Infof("Discarding residual changes of branch '%s': %s\n", branch, strings.Join(residue, ", "))
+	}
+	return plumbing.ZeroHash, nil
+}
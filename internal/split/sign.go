@@ -0,0 +1,119 @@
+package split
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// commandSigner signs commits by piping the encoded commit to an external
+// program, the same way git does for gpg and ssh signatures.
+type commandSigner struct {
+	program string
+	args    []string
+	// Temporary public key file written for "key::" ssh signing keys
+	tmpKey string
+}
+
+func (s *commandSigner) Sign(message io.Reader) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.program, s.args...)
+	cmd.Stdin = message
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed to sign the commit: %v: %s", s.program, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func (s *commandSigner) Close() {
+	if s.tmpKey != "" {
+		os.Remove(s.tmpKey)
+	}
+}
+
+// newCommitSigner builds the signer for --sign from the signing key (--sign-key
+// or else user.signingkey) and the gpg.format, gpg.program and gpg.ssh.program
+// settings of git config.
+func newCommitSigner(key string) (*commandSigner, error) {
+	if key == "" {
+		var err error
+		if key, err = gitConfigValue("user.signingkey"); err != nil {
+			return nil, err
+		}
+	}
+	if key == "" {
+		return nil, fmt.Errorf("--sign requires a signing key; pass --sign-key or set user.signingkey in git config")
+	}
+	format, err := gitConfigValue("gpg.format")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "", "openpgp":
+		program, err := gitConfigValue("gpg.program")
+		if err != nil {
+			return nil, err
+		}
+		if program == "" {
+			program = "gpg"
+		}
+		return &commandSigner{program: program, args: []string{"--status-fd=2", "-bsau", key}}, nil
+	case "ssh":
+		program, err := gitConfigValue("gpg.ssh.program")
+		if err != nil {
+			return nil, err
+		}
+		if program == "" {
+			program = "ssh-keygen"
+		}
+		signer := &commandSigner{program: program}
+		if literal, ok := strings.CutPrefix(key, "key::"); ok {
+			f, err := os.CreateTemp("", "split-signing-key-*.pub")
+			if err != nil {
+				return nil, fmt.Errorf("failed to write ssh signing key: %v", err)
+			}
+			defer f.Close()
+			if _, err := f.WriteString(literal + "\n"); err != nil {
+				os.Remove(f.Name())
+				return nil, fmt.Errorf("failed to write ssh signing key: %v", err)
+			}
+			key, signer.tmpKey = f.Name(), f.Name()
+		} else if rest, ok := strings.CutPrefix(key, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand ssh signing key path '%s': %v", key, err)
+			}
+			key = filepath.Join(home, rest)
+		}
+		if _, err := os.Stat(key); err != nil {
+			signer.Close()
+			return nil, fmt.Errorf("ssh signing key '%s' is not available: %v", key, err)
+		}
+		signer.args = []string{"-Y", "sign", "-n", "git", "-f", key}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported gpg.format '%s' for --sign (expected openpgp or ssh)", format)
+	}
+}
+
+// gitConfigValue returns the value of key from git config, or an empty string
+// when it is not set.
+func gitConfigValue(key string) (string, error) {
+	out, err := exec.Command("git", "config", "--get", key).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read '%s' from git config: %v", key, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,52 @@
+package split
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSince turns a --since value into the earliest commit time to keep. It
+// accepts Go durations, a number of days such as "7d", and dates in
+// YYYY-MM-DD or RFC 3339 format.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value '%s' (expected a duration like 72h or 7d, or a date like 2024-01-31)", value)
+}
+
+// FilterSince keeps the diff files whose most recent commit in logs was made
+// at or after since.
+func FilterSince(diff []DiffFile, since time.Time, logs *CommitLogs) ([]DiffFile, error) {
+	var filtered []DiffFile
+	for _, file := range diff {
+		last, ok, err := logs.LastCommitTime(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			Verbosef("Skipping '%s': no commit on the source branch\n", file.Name)
+			continue
+		}
+		if last.Before(since) {
+			Verbosef("Skipping '%s': last changed %s\n", file.Name, last.Format(time.RFC3339))
+			continue
+		}
+		filtered = append(filtered, file)
+	}
+	Infof("Filtered out %d of %d diff file(s) with --since\n", len(diff)-len(filtered), len(diff))
+	return filtered, nil
+}
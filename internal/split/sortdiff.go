@@ -0,0 +1,41 @@
+package split
+
+import (
+	"sort"
+	"time"
+)
+
+// sortDiffFiles orders the diff files according to --sort: by path, by the
+// time of their most recent commit in logs (oldest first, by path within the
+// same time), or in the order of the tree diff.
+func sortDiffFiles(diff []DiffFile, mode string, logs *CommitLogs) error {
+	switch mode {
+	case "path":
+		sort.SliceStable(diff, func(i, j int) bool {
+			return diff[i].Name < diff[j].Name
+		})
+	case "mtime":
+		times := make(map[string]time.Time, len(diff))
+		for _, file := range diff {
+			last, ok, err := logs.LastCommitTime(file.Name)
+			if err != nil {
+				return err
+			}
+			if ok {
+				times[file.Name] = last
+			}
+		}
+		sort.SliceStable(diff, func(i, j int) bool {
+			ti, tj := times[diff[i].Name], times[diff[j].Name]
+			if !ti.Equal(tj) {
+				// Files without a commit on the source branch go last
+				if ti.IsZero() || tj.IsZero() {
+					return tj.IsZero()
+				}
+				return ti.Before(tj)
+			}
+			return diff[i].Name < diff[j].Name
+		})
+	}
+	return nil
+}
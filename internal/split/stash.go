@@ -0,0 +1,92 @@
+package split
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// With --no-commit every group is stashed under this message, followed by the
+// branch name, so that its entry can be found again
+const stashMessagePrefix = "git-split-branch: "
+
+// stashStaged saves the changes staged for branch with git stash, leaving the
+// worktree clean for the next branch. go-git has no stash support, so this
+// shells out to git like CommitLogs.
+func stashStaged(branch string) error {
+	out, err := exec.Command("git", "stash", "push", "--staged", "-m", stashMessagePrefix+branch).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to stash staged changes of branch '%s': %v: %s", branch, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// printStashInstructions tells how to restore the stashed changes of each
+// branch created with --no-commit. Stashes of earlier branches have higher
+// indexes, so popping them in the printed order keeps the later indexes valid.
+func printStashInstructions(results []BranchResult) error {
+	out, err := exec.Command("git", "stash", "list", "--format=%gd%x00%s").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list stashes: %v", err)
+	}
+	refs := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		ref, subject, ok := strings.Cut(line, "\x00")
+		if !ok {
+			continue
+		}
+		_, branch, ok := strings.Cut(subject, ": "+stashMessagePrefix)
+		if _, seen := refs[branch]; ok && !seen {
+			refs[branch] = ref
+		}
+	}
+
+	Infof("\nNo commits were created. The staged changes of each branch were stashed; to review and commit them run:\n")
+	for _, result := range results {
+		if ref, ok := refs[result.Name]; ok && result.Stashed {
+			Infof("  git checkout %s && git stash pop --index %s && git commit\n", result.Name, ref)
+		}
+	}
+	return nil
+}
+
+// snapshotChanges stashes the staged, unstaged and untracked changes of the
+// worktree for --preserve-index and returns the stash commit, or an empty
+// string when there was nothing to save.
+func snapshotChanges() (string, error) {
+	before := stashHead()
+	out, err := exec.Command("git", "stash", "push", "--include-untracked", "-m", "git-split-branch: preserved changes").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to stash the current changes: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if after := stashHead(); after != before {
+		return after, nil
+	}
+	return "", nil
+}
+
+// restoreChanges applies the stash saved by snapshotChanges, staged changes
+// included, and drops it.
+func restoreChanges(hash string) error {
+	if out, err := exec.Command("git", "stash", "apply", "--index", hash).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restore the stashed changes (%s): %v: %s", ShortHash(hash), err, strings.TrimSpace(string(out)))
+	}
+	out, err := exec.Command("git", "stash", "list", "--format=%gd %H").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list stashes: %v", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if ref, entry, ok := strings.Cut(line, " "); ok && entry == hash {
+			if out, err := exec.Command("git", "stash", "drop", ref).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to drop stash %s: %v: %s", ref, err, strings.TrimSpace(string(out)))
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func stashHead() string {
+	out, _ := exec.Command("git", "rev-parse", "-q", "--verify", "refs/stash").Output()
+	return strings.TrimSpace(string(out))
+}
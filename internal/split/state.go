@@ -0,0 +1,143 @@
+package split
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// Name of the state file kept in the git directory while branches are created
+const stateFileName = "split-branch-state.json"
+
+// splitState records the groups finished by a run of CreateBranches so that
+// an interrupted split can be continued with --resume.
+type splitState struct {
+	// Identifies the start commit, source tree and split config of the run
+	Fingerprint string `json:"fingerprint"`
+	// Branch that was checked out when the split started
+	Branch    string         `json:"branch"`
+	Completed []BranchResult `json:"completed"`
+	// Branch being created when the state was written; it may hold a partial
+	// or an unrecorded commit and is always recreated
+	InProgress string `json:"inProgress,omitempty"`
+}
+
+func statePath(repo *git.Repository) (string, error) {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", fmt.Errorf("the repository has no git directory to keep the split state in")
+	}
+	return filepath.Join(storage.Filesystem().Root(), stateFileName), nil
+}
+
+// splitFingerprint hashes everything that decides which branches a split
+// creates, so a state file is only resumed by the same split.
+func splitFingerprint(startCommit *object.Commit, sourceTree *object.Tree, cfg SplitConfig) (string, error) {
+	data, err := json.Marshal(cfg.Branches)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%s\n", startCommit.Hash, sourceTree.Hash)
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// loadSplitState returns the state left by an interrupted split, or nil.
+func loadSplitState(path string) (*splitState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read split state: %v", err)
+	}
+	var state splitState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse split state '%s': %v", path, err)
+	}
+	return &state, nil
+}
+
+func saveSplitState(path string, state *splitState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write split state: %v", err)
+	}
+	return nil
+}
+
+func removeSplitState(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		Infof("Warning: failed to remove split state '%s': %v\n", path, err)
+	}
+}
+
+// resumeSplitState decides what to do with the state of an interrupted split
+// before any branch is created and returns the groups that are already done.
+// With --resume they must still point at the commits that were recorded; with
+// --restart their branches are deleted and the split starts over.
+func resumeSplitState(repo *git.Repository, path string, state *splitState, fingerprint, currentBranch string, resume, restart bool) ([]BranchResult, error) {
+	if state == nil {
+		if resume {
+			Infof("No interrupted split to resume, starting from the first branch\n")
+		}
+		return nil, nil
+	}
+	if !resume && !restart {
+		return nil, fmt.Errorf("a previous split was interrupted after %d branch group(s); pass --resume to continue it or --restart to start over", len(state.Completed))
+	}
+	if resume && state.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("the interrupted split used a different source, start commit or split config; pass --restart to start over")
+	}
+	if state.Branch != currentBranch {
+		return nil, fmt.Errorf("the interrupted split started from '%s'; check it out again first (git checkout -f %s)", state.Branch, state.Branch)
+	}
+	if state.InProgress != "" {
+		if _, err := repo.Reference(plumbing.NewBranchReferenceName(state.InProgress), true); err == nil {
+			if err := repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(state.InProgress)); err != nil {
+				return nil, fmt.Errorf("failed to delete branch '%s' of the interrupted split: %v", state.InProgress, err)
+			}
+			Infof("Deleted branch '%s', which the interrupted split had not finished\n", state.InProgress)
+		}
+	}
+	if restart {
+		for _, result := range state.Completed {
+			if result.Hash == "" || result.Skipped {
+				continue
+			}
+			refName := plumbing.NewBranchReferenceName(result.Name)
+			if ref, err := repo.Reference(refName, true); err != nil || ref.Hash().String() != result.Hash {
+				continue
+			}
+			if err := repo.Storer.RemoveReference(refName); err != nil {
+				return nil, fmt.Errorf("failed to delete branch '%s' of the interrupted split: %v", result.Name, err)
+			}
+			Infof("Deleted branch '%s' of the interrupted split\n", result.Name)
+		}
+		removeSplitState(path)
+		return nil, nil
+	}
+	for _, result := range state.Completed {
+		if result.Hash == "" || result.Skipped || result.Stashed {
+			continue
+		}
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(result.Name), true)
+		if err != nil || ref.Hash().String() != result.Hash {
+			return nil, fmt.Errorf("branch '%s' no longer points at %s as recorded by the interrupted split; pass --restart to start over", result.Name, ShortHash(result.Hash))
+		}
+	}
+	Infof("Resuming the interrupted split after %d branch group(s)\n", len(state.Completed))
+	return state.Completed, nil
+}
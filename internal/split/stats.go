@@ -0,0 +1,34 @@
+package split
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Lines changed by a split branch, computed with --stats
+type BranchStats struct {
+	FilesChanged int `json:"filesChanged"`
+	Additions    int `json:"additions"`
+	Deletions    int `json:"deletions"`
+}
+
+func (s BranchStats) String() string {
+	return fmt.Sprintf("%d file(s) changed, %d insertion(s)(+), %d deletion(s)(-)", s.FilesChanged, s.Additions, s.Deletions)
+}
+
+// branchStats compares the commit of a branch with the commit it was created
+// on, like git diff --stat between them.
+func branchStats(parent, commit *object.Commit) (*BranchStats, error) {
+	patch, err := parent.Patch(commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the stats of commit %s: %v", ShortHash(commit.Hash.String()), err)
+	}
+	stats := &BranchStats{}
+	for _, stat := range patch.Stats() {
+		stats.FilesChanged++
+		stats.Additions += stat.Addition
+		stats.Deletions += stat.Deletion
+	}
+	return stats, nil
+}
@@ -0,0 +1,68 @@
+package split
+
+import (
+	"fmt"
+	"os"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// submoduleEntry returns the tree entry of file in commit if it is a
+// submodule (a gitlink pointing to a commit of another repository), or nil.
+func submoduleEntry(commit *object.Commit, file string) *object.TreeEntry {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil
+	}
+	entry, err := tree.FindEntry(file)
+	if err != nil || entry.Mode != filemode.Submodule {
+		return nil
+	}
+	return entry
+}
+
+// stageSubmodule points the submodule at file to commit hash in the index.
+// The content of the submodule is not checked out; like git checkout does
+// for submodules that are not initialized, only its directory is created.
+func stageSubmodule(repo *git.Repository, file string, hash plumbing.Hash) error {
+	if err := os.MkdirAll(file, 0755); err != nil {
+		return fmt.Errorf("failed to create directory of submodule '%s': %v", file, err)
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %v", err)
+	}
+	entry, err := idx.Entry(file)
+	if err == index.ErrEntryNotFound {
+		entry = idx.Add(file)
+	} else if err != nil {
+		return fmt.Errorf("failed to read index entry for '%s': %v", file, err)
+	}
+	entry.Hash = hash
+	entry.Mode = filemode.Submodule
+	entry.Size = 0
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	return nil
+}
+
+// unstageSubmodule removes the submodule at file from the index, leaving its
+// directory and content in the working tree the way git rm --cached does.
+func unstageSubmodule(repo *git.Repository, file string) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %v", err)
+	}
+	if _, err := idx.Remove(file); err != nil && err != index.ErrEntryNotFound {
+		return fmt.Errorf("failed to remove index entry for '%s': %v", file, err)
+	}
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	return nil
+}
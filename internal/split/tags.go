@@ -0,0 +1,67 @@
+package split
+
+import (
+	"fmt"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// checkExistingTags makes sure no tag of the groups exists yet before any
+// branch is created. With force the old tags are deleted.
+func checkExistingTags(repo *git.Repository, groups []BranchGroup, force bool) error {
+	var conflicts []string
+	for _, group := range groups {
+		if len(group.Files) == 0 || group.Name == KeepGroupName {
+			continue
+		}
+		refName := plumbing.NewTagReferenceName(group.Name)
+		if _, err := repo.Reference(refName, false); err != nil {
+			continue
+		}
+		if !force {
+			conflicts = append(conflicts, group.Name)
+			continue
+		}
+		if err := repo.DeleteTag(group.Name); err != nil {
+			return fmt.Errorf("failed to delete existing tag '%s': %v", group.Name, err)
+		}
+		Infof("Deleted existing tag '%s'\n", group.Name)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("tags already exist: %s (delete them, rename them in the config, or pass --force)", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// createSplitTag creates an annotated tag named after the branch on its
+// commit, with the commit message as the tag message.
+func createSplitTag(repo *git.Repository, name string, hash plumbing.Hash, msg string, tagger *object.Signature) error {
+	if _, err := repo.CreateTag(name, hash, &git.CreateTagOptions{Tagger: tagger, Message: msg}); err != nil {
+		return fmt.Errorf("failed to create tag '%s': %v", name, err)
+	}
+	return nil
+}
+
+// removeSplitTags deletes the tags created by a split that is rolled back.
+func removeSplitTags(repo *git.Repository, tags []string) {
+	for _, name := range tags {
+		if err := repo.DeleteTag(name); err != nil {
+			Infof("Warning: failed to remove tag '%s': %v\n", name, err)
+			continue
+		}
+		Infof("Removed tag '%s'\n", name)
+	}
+}
+
+// removeTaggedBranches deletes the branches of a split with --as-tags once
+// their commits are tagged; they were only needed to build the commits.
+func removeTaggedBranches(repo *git.Repository, results []BranchResult) {
+	for _, result := range results {
+		if err := repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(result.Name)); err != nil {
+			Infof("Warning: failed to remove branch '%s': %v\n", result.Name, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package split
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Default --test-pattern conventions. '%' stands for the name of the source
+// file without its extension, which the test file shares.
+var DefaultTestPatterns = []string{
+	"%_test.go",
+	"test_%.py",
+	"%_test.py",
+	"%.test.js",
+	"%.spec.js",
+	"%.test.ts",
+	"%.spec.ts",
+	"%_spec.rb",
+}
+
+// ValidateTestPatterns checks that every pattern contains exactly one '%'
+// and an extension after it.
+func ValidateTestPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.Count(pattern, "%") != 1 || strings.Contains(pattern, "/") || path.Ext(strings.SplitN(pattern, "%", 2)[1]) == "" {
+			return fmt.Errorf("invalid test pattern '%s' (expected a file name with one '%%' and an extension, like '%%_test.go')", pattern)
+		}
+	}
+	return nil
+}
+
+// TestSources maps each diff file that is a test by one of patterns to the
+// diff file it tests: the file in the same directory named after the '%' part
+// of the pattern with the test file's extension, e.g. foo_test.go to foo.go
+// and test_foo.py to foo.py. Tests without such a source are left out.
+func TestSources(diffFiles []string, patterns []string) map[string]string {
+	isDiffFile := make(map[string]bool, len(diffFiles))
+	for _, file := range diffFiles {
+		isDiffFile[file] = true
+	}
+	sources := make(map[string]string)
+	for _, file := range diffFiles {
+		base := path.Base(file)
+		for _, pattern := range patterns {
+			prefix, suffix, _ := strings.Cut(pattern, "%")
+			if len(base) <= len(prefix)+len(suffix) || !strings.HasPrefix(base, prefix) || !strings.HasSuffix(base, suffix) {
+				continue
+			}
+			stem := base[len(prefix) : len(base)-len(suffix)]
+			source := path.Join(path.Dir(file), stem+path.Ext(suffix))
+			if source != file && isDiffFile[source] {
+				sources[file] = source
+				break
+			}
+		}
+	}
+	return sources
+}
+
+// testUnits returns the diff files as units that must stay in one group: a
+// source file together with its tests, at the position of the first of
+// them, and every other file on its own.
+func testUnits(diffFiles []string, patterns []string) [][]string {
+	sources := TestSources(diffFiles, patterns)
+	unitIndex := make(map[string]int)
+	var units [][]string
+	for _, file := range diffFiles {
+		key := file
+		if source, ok := sources[file]; ok {
+			key = source
+		}
+		idx, ok := unitIndex[key]
+		if !ok {
+			idx = len(units)
+			unitIndex[key] = idx
+			units = append(units, nil)
+		}
+		units[idx] = append(units[idx], file)
+	}
+	return units
+}
+
+// fillUnits fills groups of size files in order without ever splitting a
+// unit, so a group may end up a little larger than size.
+func fillUnits(units [][]string, size int) [][]string {
+	var groups [][]string
+	var current []string
+	for _, unit := range units {
+		if len(current) >= size {
+			groups = append(groups, current)
+			current = nil
+		}
+		current = append(current, unit...)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
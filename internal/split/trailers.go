@@ -0,0 +1,32 @@
+package split
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var trailerLine = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+
+// appendTrailers adds the Split-From, Split-Base and Split-Files trailers of
+// --add-trailers for rng to msg. They join a trailer block that ends the message
+// already, and are separated from the body by a blank line otherwise.
+func appendTrailers(msg string, files int, rng Range) string {
+	trailers := fmt.Sprintf("Split-From: %s\nSplit-Base: %s\nSplit-Files: %d", rng.Source, rng.Base, files)
+	msg = strings.TrimRight(msg, "\n")
+	paragraphs := strings.Split(msg, "\n\n")
+	last := paragraphs[len(paragraphs)-1]
+	if len(paragraphs) == 1 || !isTrailerBlock(last) {
+		return msg + "\n\n" + trailers + "\n"
+	}
+	return msg + "\n" + trailers + "\n"
+}
+
+func isTrailerBlock(paragraph string) bool {
+	for _, line := range strings.Split(paragraph, "\n") {
+		if !trailerLine.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
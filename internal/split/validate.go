@@ -0,0 +1,272 @@
+package split
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ValidateSplitConfig checks that cfg defines branches with names and only
+// lists diff files.
+func ValidateSplitConfig(cfg SplitConfig, diffFiles []string) error {
+	diffSet := make(map[string]bool)
+	for _, file := range diffFiles {
+		diffSet[file] = true
+	}
+
+	var problems []string
+	if len(cfg.Branches) == 0 {
+		problems = append(problems, "no branches are defined")
+	}
+	for i, group := range cfg.Branches {
+		if strings.TrimSpace(group.Name) == "" {
+			problems = append(problems, fmt.Sprintf("branch #%d has an empty name", i+1))
+		}
+		for _, file := range group.Files {
+			if !diffSet[file] {
+				problems = append(problems, fmt.Sprintf("file '%s' in branch '%s' is not in the diff", file, group.Name))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// CumulativeGroups gives every group the files of all groups before it too,
+// for --stacked-cumulative.
+func CumulativeGroups(cfg SplitConfig) SplitConfig {
+	var cumulative SplitConfig
+	var files []string
+	seen := make(map[string]bool)
+	hunks := make(map[string][]int)
+	for _, group := range cfg.Branches {
+		for _, file := range group.Files {
+			// A file split by hunk is listed once, with the hunks of
+			// every group so far
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+		for file, numbers := range group.Hunks {
+			hunks[file] = append(hunks[file], numbers...)
+		}
+		next := BranchGroup{Name: group.Name, Files: append([]string{}, files...)}
+		if len(hunks) > 0 {
+			next.Hunks = make(map[string][]int)
+			for file, numbers := range hunks {
+				next.Hunks[file] = append([]int{}, numbers...)
+			}
+		}
+		cumulative.Branches = append(cumulative.Branches, next)
+	}
+	return cumulative
+}
+
+// SeparateKeepGroup removes the keep group from cfg and returns the files it listed.
+func SeparateKeepGroup(cfg SplitConfig) (SplitConfig, []string) {
+	var branchConfig SplitConfig
+	var kept []string
+	for _, group := range cfg.Branches {
+		if group.Name == KeepGroupName {
+			kept = append(kept, group.Files...)
+			continue
+		}
+		branchConfig.Branches = append(branchConfig.Branches, group)
+	}
+	return branchConfig, kept
+}
+
+// CheckFileAssignments returns an error listing every file assigned to more
+// than one branch group, except files split by hunk and those matching the
+// shared globs. Unless keepUnassigned is set, it warns about diff files left
+// out of every group.
+func CheckFileAssignments(cfg SplitConfig, diffFiles []string, shared []string, keepUnassigned bool) error {
+	assignments := make(map[string][]string)
+	var order []string
+	for _, group := range cfg.Branches {
+		for _, file := range group.Files {
+			if _, ok := assignments[file]; !ok {
+				order = append(order, file)
+			}
+			assignments[file] = append(assignments[file], group.Name)
+		}
+	}
+
+	var unassigned []string
+	for _, file := range diffFiles {
+		if _, ok := assignments[file]; !ok {
+			unassigned = append(unassigned, file)
+		}
+	}
+	if len(unassigned) > 0 && !keepUnassigned {
+		Infof("Warning: %d diff file(s) are not assigned to any branch:\n", len(unassigned))
+		for _, file := range unassigned {
+			Infof("- %s\n", file)
+		}
+	}
+
+	hunkSplit := hunkSplitFiles(cfg)
+	var duplicates []string
+	for _, file := range order {
+		if branches := assignments[file]; len(branches) > 1 && !hunkSplit[file] && !MatchAnyGlob(shared, file) {
+			duplicates = append(duplicates, fmt.Sprintf("'%s' is assigned to %s", file, strings.Join(branches, ", ")))
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%d file(s) are assigned to more than one branch:\n  %s", len(duplicates), strings.Join(duplicates, "\n  "))
+	}
+	return nil
+}
+
+// CheckCaseCollisions returns an error listing the files of a branch whose
+// paths differ only in case, as they overwrite each other on case-insensitive
+// filesystems such as the macOS and Windows defaults. With stacked a branch
+// also holds the files of the branches below it.
+func CheckCaseCollisions(cfg SplitConfig, stacked bool) error {
+	var collisions []string
+	seen := make(map[string]string)
+	for _, group := range cfg.Branches {
+		if group.Name == KeepGroupName {
+			continue
+		}
+		if !stacked {
+			seen = make(map[string]string)
+		}
+		for _, file := range group.Files {
+			folded := strings.ToLower(file)
+			if other, ok := seen[folded]; ok && other != file {
+				collisions = append(collisions, fmt.Sprintf("'%s' and '%s' in branch '%s'", other, file, group.Name))
+				continue
+			}
+			seen[folded] = file
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("%d pair(s) of files differ only in case and would collide on a case-insensitive filesystem:\n  %s", len(collisions), strings.Join(collisions, "\n  "))
+	}
+	return nil
+}
+
+// ValidateBranchNames reports every branch group with an invalid name at once,
+// including names used twice or clashing with each other (see refClash).
+func ValidateBranchNames(cfg SplitConfig) error {
+	var problems []string
+	for _, group := range cfg.Branches {
+		if len(group.Files) == 0 || group.Name == KeepGroupName {
+			continue
+		}
+		if err := ValidateBranchName(group.Name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	problems = append(problems, BranchNameConflicts(cfg)...)
+	if len(problems) > 0 {
+		return fmt.Errorf("%d invalid branch name(s):\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// BranchNameConflicts lists the branch groups whose name is already used by
+// another group or clashes with one, like grp and grp/sub.
+func BranchNameConflicts(cfg SplitConfig) []string {
+	count := make(map[string]int)
+	seen := make(map[string]bool)
+	var names []string
+	for _, group := range cfg.Branches {
+		if len(group.Files) == 0 || group.Name == KeepGroupName {
+			continue
+		}
+		if count[group.Name]++; !seen[group.Name] {
+			seen[group.Name] = true
+			names = append(names, group.Name)
+		}
+	}
+	var problems []string
+	for _, name := range names {
+		if count[name] > 1 {
+			problems = append(problems, fmt.Sprintf("'%s' is the name of %d branch groups", name, count[name]))
+		}
+		if other := refClash(name, seen); other != "" {
+			problems = append(problems, fmt.Sprintf("'%s' clashes with the branch group '%s'", name, other))
+		}
+	}
+	return problems
+}
+
+// refClash returns the name in names that is a parent directory of name, like
+// grp for grp/sub, or "". Git cannot have both, as it stores refs as files.
+func refClash(name string, names map[string]bool) string {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && names[name[:i]] {
+			return name[:i]
+		}
+	}
+	return ""
+}
+
+// ValidateBranchName checks name against the rules of git check-ref-format.
+func ValidateBranchName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("branch name is empty")
+	case name == "@":
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		return fmt.Errorf("'%s' must not begin or end with '/'", name)
+	case strings.HasSuffix(name, "."):
+		return fmt.Errorf("'%s' must not end with '.'", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("'%s' must not contain '..'", name)
+	case strings.Contains(name, "//"):
+		return fmt.Errorf("'%s' must not contain consecutive slashes", name)
+	case strings.Contains(name, "@{"):
+		return fmt.Errorf("'%s' must not contain '@{'", name)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("'%s' contains the invalid character %q", name, r)
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("'%s' has a component that begins with '.' or ends with '.lock'", name)
+		}
+	}
+	return nil
+}
+
+// SanitizeBranchName lowercases name, turns whitespace into dashes and drops
+// whatever ValidateBranchName would reject.
+func SanitizeBranchName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteRune('-')
+		case r < 0x20 || r == 0x7f || strings.ContainsRune("~^:?*[\\", r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	clean := strings.ReplaceAll(b.String(), "@{", "@")
+	for strings.Contains(clean, "..") {
+		clean = strings.ReplaceAll(clean, "..", ".")
+	}
+	var components []string
+	for _, component := range strings.Split(clean, "/") {
+		for strings.HasSuffix(component, ".lock") {
+			component = strings.TrimSuffix(component, ".lock")
+		}
+		if component = strings.TrimLeft(component, "."); component != "" {
+			components = append(components, component)
+		}
+	}
+	clean = strings.TrimRight(strings.Join(components, "/"), ".")
+	if clean == "@" {
+		return ""
+	}
+	return clean
+}
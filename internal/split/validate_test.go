@@ -0,0 +1,91 @@
+package split
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCaseCollisions(t *testing.T) {
+	tests := []struct {
+		name    string
+		groups  []BranchGroup
+		stacked bool
+		// Substrings of the error, or none when there is no collision
+		want []string
+	}{
+		{
+			name:   "no collision",
+			groups: []BranchGroup{{Name: "a", Files: []string{"README.md", "docs/readme.txt"}}},
+		},
+		{
+			name:   "same branch",
+			groups: []BranchGroup{{Name: "a", Files: []string{"README.md", "readme.md"}}},
+			want:   []string{"1 pair(s)", "'README.md' and 'readme.md' in branch 'a'"},
+		},
+		{
+			name:   "directory case",
+			groups: []BranchGroup{{Name: "a", Files: []string{"Docs/a.md", "docs/a.md"}}},
+			want:   []string{"'Docs/a.md' and 'docs/a.md' in branch 'a'"},
+		},
+		{
+			name: "separate branches",
+			groups: []BranchGroup{
+				{Name: "a", Files: []string{"README.md"}},
+				{Name: "b", Files: []string{"readme.md"}},
+			},
+		},
+		{
+			name: "stacked branches accumulate",
+			groups: []BranchGroup{
+				{Name: "a", Files: []string{"README.md"}},
+				{Name: "b", Files: []string{"main.go"}},
+				{Name: "c", Files: []string{"readme.md"}},
+			},
+			stacked: true,
+			want:    []string{"1 pair(s)", "'README.md' and 'readme.md' in branch 'c'"},
+		},
+		{
+			name: "stacked without collision",
+			groups: []BranchGroup{
+				{Name: "a", Files: []string{"README.md"}},
+				{Name: "b", Files: []string{"README.md", "main.go"}},
+			},
+			stacked: true,
+		},
+		{
+			name: "keep group is ignored",
+			groups: []BranchGroup{
+				{Name: KeepGroupName, Files: []string{"README.md"}},
+				{Name: "a", Files: []string{"readme.md"}},
+			},
+			stacked: true,
+		},
+		{
+			name: "several pairs",
+			groups: []BranchGroup{
+				{Name: "a", Files: []string{"A.go", "a.go"}},
+				{Name: "b", Files: []string{"B.go", "b.go"}},
+			},
+			want: []string{"2 pair(s)", "in branch 'a'", "in branch 'b'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCaseCollisions(SplitConfig{Branches: tt.groups}, tt.stacked)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package split
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// addSplitWorktree creates a temporary linked worktree at startCommit for
+// --use-worktree and makes it the working directory, so that the branches are
+// created there and the main checkout is never touched. go-git cannot add
+// worktrees, so this shells out to git like stashStaged. The returned function
+// returns to the main checkout and removes the worktree again.
+func addSplitWorktree(startCommit *object.Commit) (*git.Repository, func(), error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get working directory: %v", err)
+	}
+	dir, err := os.MkdirTemp("", "git-split-branch-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	if out, err := exec.Command("git", "worktree", "add", "--detach", dir, startCommit.Hash.String()).CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("failed to add worktree: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	remove := func() {
+		if err := os.Chdir(cwd); err != nil {
+			Infof("Warning: failed to return to '%s': %v\n", cwd, err)
+		}
+		if out, err := exec.Command("git", "worktree", "remove", "--force", dir).CombinedOutput(); err != nil {
+			Infof("Warning: failed to remove worktree '%s': %v: %s\n", dir, err, strings.TrimSpace(string(out)))
+			return
+		}
+		Verbosef("Removed worktree '%s'\n", dir)
+	}
+
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		remove()
+		return nil, nil, fmt.Errorf("failed to open worktree '%s': %v", dir, err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		remove()
+		return nil, nil, fmt.Errorf("failed to enter worktree '%s': %v", dir, err)
+	}
+	Infof("Creating the branches in temporary worktree '%s'\n", dir)
+	return repo, remove, nil
+}
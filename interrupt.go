@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// withInterrupt returns a context that is canceled on SIGINT or SIGTERM, so
+// that a split stops between steps and can be resumed instead of dying halfway.
+// A second signal terminates the process as usual.
+func withInterrupt(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/m0a/git-split-branch/internal/split"
+)
+
+// infof prints key milestones and warnings, suppressed by --quiet.
+func infof(format string, args ...interface{}) {
+	split.Infof(format, args...)
+}
+
+// verbosef prints per-file details and timings, shown only with --verbose.
+func verbosef(format string, args ...interface{}) {
+	split.Verbosef(format, args...)
+}
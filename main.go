@@ -1,209 +1,1409 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+	"unicode"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/m0a/git-split-branch/internal/split"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
+	"golang.org/x/term"
 )
 
-// Struct definitions for YAML configuration
-type BranchGroup struct {
-	Name  string   `yaml:"name"`
-	Files []string `yaml:"files"`
-}
+// The split config and result types live in internal/split
+type (
+	BranchGroup    = split.BranchGroup
+	SplitConfig    = split.SplitConfig
+	ConfigDefaults = split.ConfigDefaults
+	DiffFile       = split.DiffFile
+	BranchResult   = split.BranchResult
+	BranchStats    = split.BranchStats
+)
 
-type SplitConfig struct {
-	Branches []BranchGroup `yaml:"branches"`
+type RunReport struct {
+	DiffFiles []string       `json:"diffFiles"`
+	Config    *SplitConfig   `json:"config,omitempty"`
+	Branches  []BranchResult `json:"branches"`
 }
 
 var (
-	sourceBranch   string
-	baseBranch     string
-	filesPerBranch int
-	branchPrefix   string
+	sourceBranch     string
+	baseBranch       string
+	filesPerBranch   int
+	branchPrefix     string
+	dryRun           bool
+	dryRunMode       string
+	allowDirty       bool
+	preserveIndex    bool
+	showStats        bool
+	addTrailers      bool
+	splitBy          string
+	dirDepth         int
+	numBranches      int
+	maxBranches      int
+	commitsPerBranch int
+	overflowMode     string
+	outputFormat     string
+	verbose          bool
+	quiet            bool
+	configFile       string
+	configFormat     string
+	lenient          bool
+	allowCaseClash   bool
+	includeDeletions bool
+	includeAdds      bool
+	includeModifies  bool
+	includeRenames   bool
+	pushRemote       string
+	pushToken        string
+	openPR           bool
+	commitMsgMode    string
+	commitTmplFile   string
+	excludePatterns  []string
+	pathPrefixes     []string
+	diffSort         string
+	includePatterns  []string
+	sharedPatterns   []string
+	rollbackOnError  bool
+	resumeSplit      bool
+	useWorktree      bool
+	lfsMode          string
+	contentFilter    string
+	asTags           bool
+	alsoTag          bool
+	ignoreFilterErrs bool
+	commitMsgText    string
+	commitMsgFile    string
+	restartSplit     bool
+	forceBranches    bool
+	suffixTimestamp  bool
+	nameTmplText     string
+	nameMapFile      string
+	sanitizeNames    bool
+	keepUnassigned   bool
+	detectRenames    bool
+	renameDetection  string
+	renameThreshold  int
+	reportFile       string
+	eolMode          string
+	fileModeText     string
+	groupByPackage   bool
+	keepTests        bool
+	testPatterns     []string
+	editorCmd        string
+	manifestFile     string
+	sinceText        string
+	ignoreMissing    bool
+	authorText       string
+	dateText         string
+	signCommits      bool
+	signKey          string
+	postBranchHook   string
+	ignoreHookErrors bool
+	listOnly         bool
+	configOut        string
+	keepConfig       bool
+	interactiveTUI   bool
+	filesFrom        string
+	jobs             int
+	noCommit         bool
+	onResidue        string
+	splitHunks       bool
+	showProgress     bool
+	respectIgnore    bool
+	stacked          bool
+	stackCumulative  bool
+	fromRev          string
+	useMergeBase     bool
+	assumeYes        bool
+	splitTimeout     time.Duration
+
+	// Parsed from --file-mode; 0 keeps the permissions implied by the tree
+	filePerm os.FileMode
+	// Set when the base branch comes from split.base in git config
+	baseFromConfig bool
+	// Parsed from --commit-template before any branch is created
+	commitTmpl *template.Template
+	// Parsed from --message or --message-file; overrides --commit-msg-mode
+	fixedMsgTmpl *template.Template
+	// Parsed from --name-template before the split config is generated
+	nameTmpl *template.Template
+	// Parsed from --since; zero when diff files are not filtered by date
+	sinceTime time.Time
+	// Parsed from --author and --date (or GIT_AUTHOR_DATE); zero values
+	// fall back to git config and the time of each commit
+	authorIdent object.Signature
+	authorDate  time.Time
+	// Commit logs of base..source, read once when first needed
+	commitLogs *split.CommitLogs
+	// Parsed hunks of the files split with --split-hunks
+	splitFileHunks map[string]*split.FileHunks
+
+	// Destination for the dry-run preview and the summary; switched to stderr
+	// with --output json
+	resultOut io.Writer = os.Stdout
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "git-split-branch",
 	Short: "Split diff files between two branches into multiple branches",
-	Run:   run,
+	Long:  "Split diff files between two branches into multiple branches\n\n" + exitStatusHelp,
+	RunE:  run,
+	// main prints the error of a failed run itself
+	SilenceErrors: true,
 }
 
 func main() {
 	rootCmd.Flags().StringVarP(&sourceBranch, "source", "s", "", "Name of the source branch for diff (required)")
-	rootCmd.Flags().StringVarP(&baseBranch, "base", "b", "main", "Name of the base branch for comparison")
-	rootCmd.Flags().IntVarP(&filesPerBranch, "number", "n", 0, "Number of files per branch (required)")
+	rootCmd.Flags().StringVarP(&baseBranch, "base", "b", "main", "Name of the base branch for comparison (defaults to split.base in git config, then origin/HEAD when available)")
+	rootCmd.Flags().IntVarP(&filesPerBranch, "number", "n", 0, "Number of files per branch (required when splitting by count)")
 	rootCmd.Flags().StringVarP(&branchPrefix, "prefix", "p", "split", "Prefix for new branch names")
+	rootCmd.Flags().StringVarP(&dryRunMode, "dry-run", "d", "", "Show the branches that would be created without changing the repository; =objects also builds their commits in memory and prints the hashes")
+	rootCmd.Flags().Lookup("dry-run").NoOptDefVal = "true"
+	rootCmd.Flags().BoolVar(&allowDirty, "allow-dirty", false, "Allow running with uncommitted changes in the working tree")
+	rootCmd.Flags().BoolVar(&preserveIndex, "preserve-index", false, "Stash the staged, unstaged and untracked changes before the split and restore them afterwards")
+	rootCmd.Flags().StringVar(&splitBy, "split-by", "count", "Grouping strategy for diff files: count, dir, ext or size; or commits to split the source commits instead")
+	rootCmd.Flags().IntVar(&dirDepth, "dir-depth", 1, "Directory depth used for grouping with --split-by dir")
+	rootCmd.Flags().IntVar(&numBranches, "branches", 0, "Number of branches to balance the changed lines across with --split-by size")
+	rootCmd.Flags().IntVar(&commitsPerBranch, "commits-per-branch", 0, "Number of source commits squashed into each branch with --split-by commits")
+	rootCmd.Flags().IntVar(&maxBranches, "max-branches", 0, "Maximum number of branch groups to generate (0 means no limit)")
+	rootCmd.Flags().StringVar(&overflowMode, "overflow", "pack", "What to do with the files beyond --max-branches: pack (into the last group), drop (leave unassigned) or keep (list them in the __keep__ group)")
+	rootCmd.Flags().StringVar(&outputFormat, "output", "text", "Output format: text or json")
+	rootCmd.Flags().StringVar(&configFile, "config", "", "Path to a split config YAML file to use instead of opening the editor")
+	rootCmd.Flags().BoolVar(&lenient, "lenient", false, "Warn instead of failing when a file is assigned to more than one branch")
+	rootCmd.Flags().BoolVar(&allowCaseClash, "allow-case-collision", false, "Warn instead of failing when files of a branch differ only in case")
+	rootCmd.Flags().BoolVar(&includeDeletions, "include-deletions", true, "Include files deleted in the source branch and delete them in the split branches")
+	rootCmd.Flags().BoolVar(&includeDeletions, "include-deletes", true, "Same as --include-deletions")
+	rootCmd.Flags().BoolVar(&includeAdds, "include-adds", true, "Include files added in the source branch")
+	rootCmd.Flags().BoolVar(&includeModifies, "include-modifies", true, "Include files modified in the source branch")
+	rootCmd.Flags().BoolVar(&includeRenames, "include-renames", true, "Include files renamed in the source branch (see --detect-renames)")
+	rootCmd.Flags().StringVar(&pushRemote, "push", "", "Push each created branch to the given remote")
+	rootCmd.Flags().StringVar(&pushToken, "token", "", "Access token used to authenticate HTTPS pushes")
+	rootCmd.Flags().BoolVar(&openPR, "open-pr", false, "After pushing, open a GitHub pull request or GitLab merge request from each branch into the base branch")
+	rootCmd.Flags().StringVar(&commitMsgMode, "commit-msg-mode", "files", "Commit message style: files, latest, first-line or template")
+	rootCmd.Flags().StringVar(&commitTmplFile, "commit-template", "", "Path to a text/template file used to render commit messages")
+	rootCmd.Flags().StringVarP(&commitMsgText, "message", "m", "", "Commit message used for every branch instead of --commit-msg-mode; {{.BranchName}} and {{.Files}} are interpolated")
+	rootCmd.Flags().StringVar(&commitMsgFile, "message-file", "", "Like --message, but read the message from a file")
+	rootCmd.Flags().StringArrayVar(&excludePatterns, "exclude", nil, "Glob of diff files to leave out of the split (repeatable, supports **)")
+	rootCmd.Flags().StringArrayVar(&includePatterns, "include", nil, "Glob of diff files to split; other files are left out (repeatable, supports **)")
+	rootCmd.Flags().StringVar(&diffSort, "sort", "path", "Order of the diff files the split config is generated from: path, mtime (last commit on the source branch, oldest first) or diff (tree diff order)")
+	rootCmd.Flags().StringArrayVar(&pathPrefixes, "path", nil, "Only split diff files under this directory, relative to the repository root (repeatable)")
+	rootCmd.Flags().StringArrayVar(&sharedPatterns, "allow-shared", nil, "Glob of diff files that may be listed in several branch groups, each getting the same content (repeatable, supports **)")
+	rootCmd.Flags().BoolVar(&rollbackOnError, "rollback-on-error", true, "Delete the branches created so far if a later branch fails")
+	rootCmd.Flags().BoolVar(&resumeSplit, "resume", false, "Continue an interrupted split, keeping the branches it already created")
+	rootCmd.Flags().BoolVar(&restartSplit, "restart", false, "Delete the branches of an interrupted split and start over")
+	rootCmd.Flags().BoolVar(&useWorktree, "use-worktree", false, "Create the branches in a temporary git worktree, leaving the current checkout untouched")
+	rootCmd.Flags().StringVar(&lfsMode, "lfs", "pointer", "How to handle files with a filter attribute such as Git LFS: pointer (check out as stored in git), smudge (run the filter's smudge command) or skip (leave them out)")
+	rootCmd.Flags().StringVar(&contentFilter, "content-filter", "", "Shell command that each split file's content is piped through (stdin to stdout) before it is committed, with its path in SPLIT_FILE")
+	rootCmd.Flags().BoolVar(&ignoreFilterErrs, "ignore-filter-errors", false, "Commit the unfiltered content of a file when --content-filter fails on it instead of aborting")
+	rootCmd.Flags().BoolVar(&addTrailers, "add-trailers", false, "Append Split-From, Split-Base and Split-Files trailers to each commit message")
+	rootCmd.Flags().BoolVar(&showStats, "stats", false, "Print the files changed and lines added and removed by each branch, and their total")
+	rootCmd.Flags().BoolVar(&asTags, "as-tags", false, "Create an annotated tag on the commit of each group instead of a branch")
+	rootCmd.Flags().BoolVar(&alsoTag, "also-tag", false, "Create an annotated tag on the commit of each group in addition to its branch")
+	rootCmd.Flags().BoolVar(&forceBranches, "force", false, "Delete and recreate branches that already exist")
+	rootCmd.Flags().BoolVar(&suffixTimestamp, "suffix-timestamp", false, "Append a timestamp to branch names that already exist")
+	rootCmd.Flags().StringVar(&nameTmplText, "name-template", "", "text/template for generated branch names, e.g. '{{.Prefix}}/split-{{printf \"%02d\" .Index}}'")
+	rootCmd.Flags().BoolVar(&sanitizeNames, "sanitize-names", false, "Lowercase generated branch names, turn spaces into dashes and drop characters git does not allow, reporting each changed name")
+	rootCmd.Flags().StringVar(&nameMapFile, "name-map", "", "YAML file mapping directories to branch names for the groups of --split-by dir, e.g. 'api/v1: api-changes'")
+	rootCmd.Flags().BoolVar(&keepUnassigned, "keep-unassigned", false, "Leave diff files that are not assigned to any branch on the current branch without warning")
+	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Print per-file details and timings")
+	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print errors only")
+	rootCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Accept the generated split config without opening the editor")
+	rootCmd.Flags().BoolVar(&detectRenames, "detect-renames", false, "Detect renamed files and remove the old path in the split branch")
+	rootCmd.Flags().StringVar(&renameDetection, "rename-detection", "", "How renames are detected: off, exact (identical content only) or similar (see --rename-threshold); similar is implied by --detect-renames")
+	rootCmd.Flags().IntVar(&renameThreshold, "rename-threshold", 60, "Minimum similarity in percent for a deleted and an added file to count as a rename with --rename-detection similar")
+	rootCmd.Flags().StringVar(&reportFile, "report", "", "Write a CSV summary of the created branches to the given file")
+	rootCmd.Flags().StringVar(&eolMode, "eol", "", "Line endings for written text files: lf, crlf or native (default: follow .gitattributes)")
+	rootCmd.Flags().StringVar(&fileModeText, "file-mode", "", "Octal permissions for written files, e.g. 0600 (default: 0755 for executables and 0644 otherwise); an execute bit for the owner also makes them executable in git")
+	rootCmd.Flags().BoolVar(&groupByPackage, "group-by-package", false, "Keep Go files of the same package in the same branch when splitting by count")
+	rootCmd.Flags().BoolVar(&keepTests, "keep-tests-together", false, "Keep test files in the branch of the source file they test, even if the branch gets a little over --number")
+	rootCmd.Flags().StringSliceVar(&testPatterns, "test-pattern", split.DefaultTestPatterns, "Test file naming conventions for --keep-tests-together; '%' stands for the source file name without extension")
+	rootCmd.Flags().StringVar(&editorCmd, "editor", "", "Editor command used to edit the split config, e.g. 'code --wait' (overrides $EDITOR)")
+	rootCmd.Flags().StringVar(&manifestFile, "manifest", "", "Write a manifest with the given path (e.g. .split-manifest.yaml) into each split branch")
+	rootCmd.Flags().StringVar(&sinceText, "since", "", "Only split files last changed on the source branch within a duration (e.g. 72h, 7d) or since a date (e.g. 2024-01-31)")
+	rootCmd.Flags().BoolVar(&ignoreMissing, "ignore-missing", false, "Exit with status 0 even if files of the split config do not exist in the source branch")
+	rootCmd.Flags().StringVar(&authorText, "author", "", "Author of the split commits as 'Name <email>' (overrides GIT_AUTHOR_NAME/GIT_AUTHOR_EMAIL and git config)")
+	rootCmd.Flags().StringVar(&dateText, "date", "", "Author date of the split commits, e.g. 2024-01-31T12:00:00+09:00 (overrides GIT_AUTHOR_DATE)")
+	rootCmd.Flags().BoolVar(&signCommits, "sign", false, "Sign the split commits with gpg or ssh, following gpg.format in git config")
+	rootCmd.Flags().StringVar(&signKey, "sign-key", "", "Key used with --sign (default: user.signingkey from git config)")
+	rootCmd.Flags().StringVar(&postBranchHook, "post-branch-hook", "", "Shell command run on each branch right after its commit, with SPLIT_BRANCH, SPLIT_FILES and SPLIT_INDEX set")
+	rootCmd.Flags().BoolVar(&ignoreHookErrors, "ignore-hook-errors", false, "Only warn when --post-branch-hook fails instead of stopping the run")
+	rootCmd.Flags().BoolVar(&listOnly, "list", false, "Only print the diff files with their action and exit")
+	rootCmd.Flags().StringVar(&configFormat, "config-format", "", "Serialization of the split config: yaml, json or toml (default: from the file extension, else yaml)")
+	rootCmd.Flags().StringVar(&configOut, "config-out", "", "Write the split config to edit to this path instead of a temporary file, and keep it")
+	rootCmd.Flags().BoolVar(&keepConfig, "keep-config", false, "Keep the edited split config file instead of deleting it")
+	rootCmd.Flags().BoolVar(&interactiveTUI, "interactive-tui", false, "Assign diff files to branch groups in a terminal UI instead of editing YAML")
+	rootCmd.Flags().StringVar(&filesFrom, "files-from", "", "Split the newline separated paths read from this file ('-' for stdin) instead of the branch diff")
+	rootCmd.Flags().IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of workers reading file contents and rendering commit messages before the branches are created")
+	rootCmd.Flags().BoolVar(&noCommit, "no-commit", false, "Create the branches and stash their staged files instead of committing them")
+	rootCmd.Flags().BoolVar(&showProgress, "progress", false, "Show a progress bar with the estimated time left while the branches are created")
+	rootCmd.Flags().BoolVar(&splitHunks, "split-hunks", false, "Experimental: allow a modified file in several groups, each applying the hunks selected in its 'hunks' field")
+	rootCmd.Flags().StringVar(&onResidue, "on-residue", "stash", "What to do with changes left uncommitted in a split branch before the next checkout: commit, discard or stash")
+	rootCmd.Flags().BoolVar(&respectIgnore, "respect-gitignore", false, "Skip files matching the .gitignore rules of the base branch")
+	rootCmd.Flags().BoolVar(&stacked, "stacked", false, "Create each split branch on top of the previous one instead of the base branch")
+	rootCmd.Flags().BoolVar(&stackCumulative, "stacked-cumulative", false, "With --stacked, give each branch a single commit on the base branch with its own and all previous files")
+	rootCmd.Flags().StringVar(&fromRev, "from", "", "Commit to create the split branches from (default: the merge-base of source and base)")
+	rootCmd.Flags().BoolVar(&useMergeBase, "use-merge-base", false, "Diff the source branch against its merge-base with the base branch instead of the base tip")
+	rootCmd.Flags().DurationVar(&splitTimeout, "timeout", 0, "Stop and roll back the split when it takes longer than this, e.g. 10m (0 means no limit)")
 	rootCmd.MarkFlagRequired("source")
-	rootCmd.MarkFlagRequired("number")
+
+	cleanCmd.Flags().StringVarP(&cleanPrefix, "prefix", "p", "split", "Prefix of the split branches to delete")
+	cleanCmd.Flags().BoolVarP(&cleanYes, "yes", "y", false, "Delete the branches without asking for confirmation")
+	cleanCmd.Flags().BoolVarP(&cleanDryRun, "dry-run", "d", false, "Only list the branches that would be deleted")
+	rootCmd.AddCommand(cleanCmd)
+	diffCmd.Flags().StringVarP(&sourceBranch, "source", "s", "", "Name of the source branch for diff (required)")
+	diffCmd.Flags().StringVarP(&baseBranch, "base", "b", "main", "Name of the base branch for comparison (defaults to split.base in git config, then origin/HEAD when available)")
+	diffCmd.Flags().BoolVar(&detectRenames, "detect-renames", false, "Detect renamed files and print them with both paths")
+	diffCmd.Flags().StringArrayVar(&excludePatterns, "exclude", nil, "Glob of diff files to leave out (repeatable, supports **)")
+	diffCmd.Flags().StringArrayVar(&includePatterns, "include", nil, "Glob of diff files to print; other files are left out (repeatable, supports **)")
+	diffCmd.Flags().StringArrayVar(&pathPrefixes, "path", nil, "Only print diff files under this directory, relative to the repository root (repeatable)")
+	diffCmd.Flags().BoolVarP(&diffNullTerminated, "null", "z", false, "End every field with a NUL byte instead of separating them with tabs and newlines")
+	diffCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Print how the diff was computed on stderr")
+	diffCmd.MarkFlagRequired("source")
+	diffCmd.RegisterFlagCompletionFunc("source", completeBranches)
+	diffCmd.RegisterFlagCompletionFunc("base", completeBranches)
+	rootCmd.AddCommand(diffCmd)
+	mergeCmd.Flags().StringVarP(&mergePrefix, "prefix", "p", "split", "Prefix of the split branches to merge")
+	mergeCmd.Flags().StringVar(&mergeInto, "into", "", "Name of the integration branch to create (required)")
+	mergeCmd.Flags().StringVarP(&mergeFrom, "base", "b", "main", "Branch the integration branch starts from (defaults to split.base in git config, then origin/HEAD when available)")
+	mergeCmd.Flags().BoolVarP(&mergeDryRun, "dry-run", "d", false, "Only list the branches in the order they would be merged")
+	mergeCmd.MarkFlagRequired("into")
+	mergeCmd.RegisterFlagCompletionFunc("base", completeBranches)
+	rootCmd.AddCommand(mergeCmd)
+	applyGitConfigDefaults()
+
+	rootCmd.RegisterFlagCompletionFunc("source", completeBranches)
+	rootCmd.RegisterFlagCompletionFunc("base", completeBranches)
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(completionCmd)
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		log.Print(err)
+		os.Exit(exitCode(err))
 	}
 }
 
-func run(cmd *cobra.Command, args []string) {
+func run(cmd *cobra.Command, args []string) error {
+	// Errors past this point are not about the usage
+	cmd.SilenceUsage = true
+	if err := validateSplitFlags(cmd); err != nil {
+		return fmt.Errorf("Invalid arguments: %w", err)
+	}
+	if outputFormat == "json" {
+		resultOut = os.Stderr
+	}
+	switch {
+	case quiet:
+		split.Verbosity = split.LevelQuiet
+	case verbose:
+		split.Verbosity = split.LevelVerbose
+	}
+	report := RunReport{DiffFiles: []string{}, Branches: []BranchResult{}}
+	ctx := cmd.Context()
+	if splitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, splitTimeout, fmt.Errorf("the --timeout of %v was reached", splitTimeout))
+		defer cancel()
+	}
+
+	if commitMsgMode == "template" {
+		tmpl, err := split.LoadCommitTemplate(commitTmplFile)
+		if err != nil {
+			return fmt.Errorf("Failed to load commit template: %w", err)
+		}
+		commitTmpl = tmpl
+	}
+	if commitMsgText != "" || commitMsgFile != "" {
+		tmpl, err := split.LoadFixedMessage(commitMsgText, commitMsgFile)
+		if err != nil {
+			return fmt.Errorf("Failed to load commit message: %w", err)
+		}
+		fixedMsgTmpl = tmpl
+	}
+	if nameTmplText != "" {
+		tmpl, err := template.New("name").Parse(nameTmplText)
+		if err != nil {
+			return fmt.Errorf("Failed to parse name template: %w", err)
+		}
+		nameTmpl = tmpl
+	}
+	if nameMapFile != "" {
+		names, err := loadNameMap(nameMapFile)
+		if err != nil {
+			return fmt.Errorf("Failed to load name map: %w", err)
+		}
+		nameMap = names
+	}
+
 	repo, err := openRepository()
 	if err != nil {
-		log.Fatalf("Critical Error: %v", err)
+		return fmt.Errorf("Critical Error: %w", err)
+	}
+	bare := split.IsBareRepository(repo)
+	if bare && !useWorktree && !listOnly && !dryRun {
+		return fmt.Errorf("Critical Error: bare repository not supported, as it has no working tree to create the branches in; pass --use-worktree to create them in a temporary worktree")
+	}
+	// --dry-run and --use-worktree never touch the current checkout and
+	// --preserve-index stashes its changes, so it may be dirty
+	if !allowDirty && !listOnly && !dryRun && !useWorktree && !preserveIndex && !bare {
+		if err := split.CheckCleanWorktree(repo); err != nil {
+			return fmt.Errorf("Pre-flight check failed: %w", err)
+		}
+	}
+	if split.Verbosity >= split.LevelVerbose {
+		displayBranches(repo)
+	}
+
+	if !cmd.Flags().Changed("base") && !baseFromConfig {
+		if detected, ok := split.DetectDefaultBranch(repo); ok {
+			baseBranch = detected
+			infof("Auto-detected base branch '%s' from origin/HEAD\n", baseBranch)
+		}
+	}
+	commitLogs = split.NewCommitLogs(split.Range{Base: baseBranch, Source: sourceBranch})
+
+	if pushRemote != "" {
+		if _, err := repo.Remote(pushRemote); err != nil {
+			return fmt.Errorf("Failed to find remote '%s': %v", pushRemote, err)
+		}
 	}
-	displayBranches(repo)
 
 	baseCommit, baseTree, err := getBranchCommitAndTree(repo, baseBranch)
 	if err != nil {
-		log.Fatalf("Failed to get base branch details: %v", err)
+		return fmt.Errorf("Failed to get base branch details: %w", err)
 	}
 
-	_, sourceTree, err := getBranchCommitAndTree(repo, sourceBranch)
+	sourceCommit, sourceTree, err := getBranchCommitAndTree(repo, sourceBranch)
 	if err != nil {
-		log.Fatalf("Failed to get source branch details: %v", err)
+		return fmt.Errorf("Failed to get source branch details: %w", err)
 	}
-
-	diffFiles, err := getDiffFiles(baseTree, sourceTree)
+	if sourceCommit.Hash == baseCommit.Hash {
+		return fmt.Errorf("Source '%s' and base '%s' point to the same commit (%s); %w", sourceBranch, baseBranch, split.ShortHash(baseCommit.Hash.String()), ErrNothingToSplit)
+	}
+	if isAncestor, err := sourceCommit.IsAncestor(baseCommit); err != nil {
+		return fmt.Errorf("Failed to compare source and base branches: %w", err)
+	} else if isAncestor {
+		infof("Warning: source '%s' is an ancestor of base '%s' and has no changes of its own; the diff only undoes changes made on the base branch.\n", sourceBranch, baseBranch)
+	}
+	startCommit, err := split.StartCommit(repo, split.Range{Base: baseBranch, Source: sourceBranch}, fromRev, baseCommit, sourceCommit)
 	if err != nil {
-		log.Fatalf("Failed to get diff files: %v", err)
+		return fmt.Errorf("Failed to determine the start commit of the split branches: %w", err)
+	}
+	// The hunks are applied to the files of the start commit, so they are
+	// numbered against it rather than against the base
+	startTree, err := startCommit.Tree()
+	if err != nil {
+		return fmt.Errorf("Failed to get tree of the start commit: %w", err)
+	}
+	if useMergeBase {
+		mergeBaseCommit, err := split.MergeBase(baseCommit, sourceCommit)
+		if err != nil {
+			return fmt.Errorf("Failed to compute the merge-base: %w", err)
+		}
+		if mergeBaseCommit == nil {
+			return fmt.Errorf("--use-merge-base: '%s' and '%s' have no common ancestor", baseBranch, sourceBranch)
+		}
+		if baseTree, err = mergeBaseCommit.Tree(); err != nil {
+			return fmt.Errorf("Failed to get tree of the merge-base: %w", err)
+		}
+		baseCommit = mergeBaseCommit
+		infof("Diffing '%s' against the merge-base %s\n", sourceBranch, split.ShortHash(baseCommit.Hash.String()))
+	}
+
+	if splitBy == "commits" {
+		ctx, stop := withInterrupt(ctx)
+		defer stop()
+		results, err := splitByCommits(ctx, repo, startCommit, sourceCommit)
+		if results != nil {
+			printSummary(results)
+			if reportFile != "" {
+				if err := writeCSVReport(reportFile, results); err != nil {
+					return fmt.Errorf("Failed to write report: %w", err)
+				}
+				infof("Wrote report to '%s'\n", reportFile)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to create branches: %w", err)
+		}
+		if results != nil {
+			report.Branches = results
+		}
+		return writeReport(report)
+	}
+
+	var diff []DiffFile
+	if filesFrom != "" {
+		files, err := readFilesFrom(filesFrom)
+		if err != nil {
+			return fmt.Errorf("Failed to read --files-from: %w", err)
+		}
+		if diff, err = split.FilesFromDiff(files, baseTree, sourceTree, includeDeletions); err != nil {
+			return fmt.Errorf("Invalid --files-from: %w", err)
+		}
+	} else if diff, err = split.DiffFiles(ctx, baseTree, sourceTree, diffOptions()); err != nil {
+		return fmt.Errorf("Failed to get diff files: %w", err)
+	}
+	if !sinceTime.IsZero() {
+		diff, err = split.FilterSince(diff, sinceTime, commitLogs)
+		if err != nil {
+			return fmt.Errorf("Failed to filter diff files with --since: %w", err)
+		}
+	}
+	if listOnly {
+		if err := printDiffList(diff); err != nil {
+			return fmt.Errorf("Failed to print diff files: %w", err)
+		}
+		if splitHunks && outputFormat == "text" {
+			printHunkHeaders(diff, startTree, sourceTree)
+		}
+		return nil
 	}
+	diffFiles := split.FileNames(diff)
 
 	if len(diffFiles) == 0 {
-		fmt.Println("No diff files found.")
-		return
+		infof("No diff files found.\n")
+		return writeReport(report)
+	}
+	report.DiffFiles = diffFiles
+	if manifestFile != "" {
+		for _, file := range diffFiles {
+			if file == manifestFile {
+				return fmt.Errorf("--manifest '%s' is also a diff file; choose another path", manifestFile)
+			}
+		}
+	}
+
+	var editedConfig SplitConfig
+	interactive := false
+	if configFile != "" {
+		editedConfig, err = loadConfigFile(configFile, diffFiles)
+		if err != nil {
+			return fmt.Errorf("Failed to load config file: %w", split.ConfigError(err))
+		}
+		if err := split.ValidateSplitConfig(editedConfig, diffFiles); err != nil {
+			return fmt.Errorf("Invalid config file: %w", split.ConfigError(err))
+		}
+	} else if assumeYes {
+		editedConfig, err = createSplitConfig(diff, sourceTree)
+		if err != nil {
+			return fmt.Errorf("Failed to create split config: %w", err)
+		}
+		infof("Using the generated split config without opening the editor\n")
+		if configOut != "" {
+			if _, err := createTempYAMLFile(editedConfig); err != nil {
+				return fmt.Errorf("Failed to write split config: %w", err)
+			}
+			infof("Wrote split config to '%s'\n", configOut)
+		}
+	} else if interactiveTUI {
+		// Without --number there is nothing to start from, so every file
+		// begins unassigned
+		var initial SplitConfig
+		if splitBy != "count" || cmd.Flags().Changed("number") {
+			initial, err = createSplitConfig(diff, sourceTree)
+			if err != nil {
+				return fmt.Errorf("Failed to create split config: %w", err)
+			}
+		}
+		editedConfig, err = selectGroupsTUI(diffFiles, initial)
+		if err != nil {
+			return fmt.Errorf("Failed to select branch groups: %w", err)
+		}
+		interactive = true
+	} else {
+		cfg, err := createSplitConfig(diff, sourceTree)
+		if err != nil {
+			return fmt.Errorf("Failed to create split config: %w", err)
+		}
+		tmpFileName, err := createTempYAMLFile(cfg)
+		if err != nil {
+			return fmt.Errorf("Failed to create temporary YAML file: %w", err)
+		}
+
+		editedConfig, err = editConfigUntilValid(tmpFileName, diffFiles)
+		if err != nil {
+			return fmt.Errorf("Failed to read edited YAML file: %w", err)
+		}
+		interactive = true
 	}
 
-	cfg := createSplitConfig(diffFiles)
-	tmpFileName, err := createTempYAMLFile(cfg)
+	if err := applyConfigDefaults(cmd, repo, editedConfig.Defaults); err != nil {
+		return fmt.Errorf("Invalid defaults in split config: %w", split.ConfigError(err))
+	}
+	if openPR && !dryRun {
+		if pushRemote == "" {
+			return fmt.Errorf("Invalid arguments: --open-pr requires --push")
+		}
+		if _, _, err := pullRequestForge(repo); err != nil {
+			return fmt.Errorf("Cannot open pull requests: %w", err)
+		}
+	}
+	if err := split.ValidateBranchNames(editedConfig); err != nil {
+		return fmt.Errorf("Invalid split config: %w", split.ConfigError(err))
+	}
+	if splitFileHunks, err = split.LoadSplitHunks(editedConfig, startTree, sourceTree, splitHunks); err != nil {
+		return fmt.Errorf("Invalid split config: %w", split.ConfigError(err))
+	}
+	if err := split.CheckFileAssignments(editedConfig, diffFiles, sharedPatterns, keepUnassigned); err != nil {
+		if !lenient {
+			return fmt.Errorf("Invalid split config: %w", split.ConfigError(err))
+		}
+		infof("Warning: %v\n", err)
+	}
+	if err := split.CheckCaseCollisions(editedConfig, stacked); err != nil {
+		if !allowCaseClash {
+			return fmt.Errorf("Invalid split config: %w (pass --allow-case-collision to continue anyway)", split.ConfigError(err))
+		}
+		infof("Warning: %v\n", err)
+	}
+
+	report.Config = &editedConfig
+	branchConfig, kept := split.SeparateKeepGroup(editedConfig)
+	if len(kept) > 0 {
+		infof("Keeping %d file(s) listed in '%s' on the current branch\n", len(kept), split.KeepGroupName)
+	}
+	if stackCumulative {
+		branchConfig = split.CumulativeGroups(branchConfig)
+	}
+
+	if dryRun {
+		if err := split.PrintDryRun(resultOut, branchConfig, messageOptions()); err != nil {
+			return fmt.Errorf("Failed to preview branches: %w", err)
+		}
+		if dryRunMode == "objects" {
+			if err := split.PrintDryRunObjects(resultOut, repo, startCommit, sourceTree, branchConfig, split.Renames(diff), branchOptions()); err != nil {
+				return fmt.Errorf("Failed to build commits in memory: %w", err)
+			}
+		}
+		return writeReport(report)
+	}
+
+	if interactive {
+		ok, err := confirmSplit(branchConfig, startCommit)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			infof("Aborted; no branches were created.\n")
+			return nil
+		}
+	}
+
+	// Signals are only caught from here on, so an editor still gets Ctrl-C
+	ctx, stop := withInterrupt(ctx)
+	defer stop()
+	results, err := split.CreateBranches(ctx, repo, startCommit, baseCommit, sourceTree, branchConfig, split.Renames(diff), branchOptions())
+	markSharedFiles(results)
+	// The branches that were pushed get their pull requests even when a
+	// later branch failed, unless the run was interrupted
+	var prErr error
+	if openPR && results != nil && !errors.Is(err, ErrInterrupted) {
+		prErr = openPullRequests(repo, results)
+	}
+	if results != nil {
+		printSummary(results)
+		if reportFile != "" {
+			if err := writeCSVReport(reportFile, results); err != nil {
+				return fmt.Errorf("Failed to write report: %w", err)
+			}
+			infof("Wrote report to '%s'\n", reportFile)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Failed to create temporary YAML file: %v", err)
+		if prErr != nil {
+			infof("Warning: %v\n", prErr)
+		}
+		return fmt.Errorf("Failed to create branches: %w", err)
+	}
+	report.Branches = results
+	if err := writeReport(report); err != nil {
+		return err
+	}
+	if prErr != nil {
+		return fmt.Errorf("Failed to open pull requests: %w", prErr)
+	}
+
+	if missing := missingFiles(results); len(missing) > 0 {
+		infof("\nThe following files do not exist in SOURCE branch and were skipped:\n")
+		for _, file := range missing {
+			infof("- %s\n", file)
+		}
+		if !ignoreMissing {
+			return ErrMissingFiles
+		}
+	}
+	return nil
+}
+
+// splitByCommits implements --split-by commits: the commits of the source
+// branch are grouped in ranges of --commits-per-branch, and each range is
+// squashed into a branch of its own (see split.SplitByCommits).
+func splitByCommits(ctx context.Context, repo *git.Repository, startCommit, sourceCommit *object.Commit) ([]BranchResult, error) {
+	ranges, err := split.CommitRanges(startCommit, sourceCommit, commitsPerBranch)
+	if err != nil {
+		return nil, err
+	}
+	commits := 0
+	for _, commitRange := range ranges {
+		commits += len(commitRange)
+	}
+	infof("Number of commits: %d\n", commits)
+	infof("Number of branches to be created: %d\n", len(ranges))
+
+	var names []string
+	for i := range ranges {
+		name, err := branchName(i+1, "")
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if dryRun {
+		split.PrintCommitRanges(resultOut, ranges, names)
+		return nil, nil
 	}
+	return split.SplitByCommits(ctx, repo, startCommit, ranges, names, branchOptions())
+}
 
-	if err := editYAMLFile(tmpFileName); err != nil {
-		log.Fatalf("Failed to edit YAML file: %v", err)
+// printHunkHeaders lists the numbered hunks of every modified diff file for
+// --list with --split-hunks.
+func printHunkHeaders(diff []DiffFile, startTree, sourceTree *object.Tree) {
+	for _, file := range diff {
+		if file.Action != split.ActionModify {
+			continue
+		}
+		hunks, err := split.LoadFileHunks(startTree, sourceTree, file.Name)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "\n%s\n", file.Name)
+		for i, header := range hunks.Headers() {
+			fmt.Fprintf(os.Stdout, "  %d: %s\n", i+1, header)
+		}
 	}
+}
 
-	editedConfig, err := readEditedYAMLFile(tmpFileName)
+// confirmSplit asks whether to create the branches of cfg on startCommit
+// after the config was edited. It does not ask when there is no terminal to
+// answer on.
+func confirmSplit(cfg SplitConfig, startCommit *object.Commit) (bool, error) {
+	input, err := terminalInput()
 	if err != nil {
-		log.Fatalf("Failed to read edited YAML file: %v", err)
+		return false, err
+	}
+	if input != os.Stdin {
+		defer input.Close()
 	}
+	if !term.IsTerminal(int(input.Fd())) {
+		return true, nil
+	}
+	count := 0
+	for _, group := range cfg.Branches {
+		if len(group.Files) > 0 {
+			count++
+		}
+	}
+	answer, err := promptLine(bufio.NewReader(input), fmt.Sprintf("Create %d branch(es) from commit %s (base '%s')? [y/N]: ", count, split.ShortHash(startCommit.Hash.String()), baseBranch))
+	if err != nil {
+		return false, fmt.Errorf("Failed to confirm: %w", err)
+	}
+	return answer == "y" || answer == "yes", nil
+}
+
+func missingFiles(results []BranchResult) []string {
+	var missing []string
+	for _, result := range results {
+		missing = append(missing, result.Missing...)
+	}
+	return missing
+}
 
-	if err := createBranches(repo, baseCommit, sourceTree, editedConfig); err != nil {
-		log.Fatalf("Failed to create branches: %v", err)
+func branchStatus(result BranchResult) string {
+	switch {
+	case result.Skipped:
+		return "skipped"
+	case result.Stashed:
+		return "stashed"
+	case result.Pushed:
+		return "pushed"
+	default:
+		return "committed"
 	}
 }
 
+func printSummary(results []BranchResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintln(resultOut, "\nSummary:")
+	w := tabwriter.NewWriter(resultOut, 0, 0, 2, ' ', 0)
+	if showStats {
+		fmt.Fprintln(w, "BRANCH\tCOMMIT\tFILES\tLINES\tSTATUS")
+	} else {
+		fmt.Fprintln(w, "BRANCH\tCOMMIT\tFILES\tSTATUS")
+	}
+	for _, result := range results {
+		if !showStats {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", result.Name, split.ShortHash(result.Hash), len(result.Files), branchStatus(result))
+			continue
+		}
+		lines := ""
+		if result.Stats != nil {
+			lines = fmt.Sprintf("+%d -%d", result.Stats.Additions, result.Stats.Deletions)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", result.Name, split.ShortHash(result.Hash), len(result.Files), lines, branchStatus(result))
+	}
+	w.Flush()
+	if showStats {
+		printStatsTotal(results)
+	}
+	printSharedFiles(results)
+}
+
+// printStatsTotal prints the stats of all branches added up.
+func printStatsTotal(results []BranchResult) {
+	var total BranchStats
+	for _, result := range results {
+		if result.Stats != nil {
+			total.FilesChanged += result.Stats.FilesChanged
+			total.Additions += result.Stats.Additions
+			total.Deletions += result.Stats.Deletions
+		}
+	}
+	fmt.Fprintf(resultOut, "Total: %s\n", total)
+}
+
+func writeCSVReport(path string, results []BranchResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file '%s': %v", path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	records := [][]string{{"branch", "commit", "files", "status"}}
+	for _, result := range results {
+		records = append(records, []string{result.Name, result.Hash, strconv.Itoa(len(result.Files)), branchStatus(result)})
+	}
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write report file '%s': %v", path, err)
+	}
+	return nil
+}
+
+func writeReport(report RunReport) error {
+	if outputFormat != "json" {
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("Failed to write JSON output: %w", err)
+	}
+	return nil
+}
+
+func validateSplitFlags(cmd *cobra.Command) error {
+	switch dryRunMode {
+	case "", "false":
+		dryRun = false
+	case "true", "objects":
+		dryRun = true
+	default:
+		return fmt.Errorf("unknown --dry-run value '%s' (expected true, false or objects)", dryRunMode)
+	}
+	if dryRunMode == "objects" && splitBy == "commits" {
+		return fmt.Errorf("--dry-run=objects cannot be used with --split-by commits")
+	}
+	switch splitBy {
+	case "count":
+		if configFile == "" && !listOnly && !interactiveTUI && !cmd.Flags().Changed("number") {
+			return fmt.Errorf("--number is required when splitting by count")
+		}
+		// 0 passes the check above, but would divide by zero
+		if cmd.Flags().Changed("number") && filesPerBranch < 1 {
+			return fmt.Errorf("--number must be at least 1, got %d", filesPerBranch)
+		}
+	case "dir":
+		if groupByPackage {
+			return fmt.Errorf("--group-by-package can only be used when splitting by count")
+		}
+		if dirDepth < 1 {
+			return fmt.Errorf("--dir-depth must be at least 1, got %d", dirDepth)
+		}
+	case "ext":
+		if groupByPackage {
+			return fmt.Errorf("--group-by-package can only be used when splitting by count")
+		}
+	case "size":
+		if groupByPackage {
+			return fmt.Errorf("--group-by-package can only be used when splitting by count")
+		}
+		if configFile == "" && !listOnly && numBranches < 1 {
+			return fmt.Errorf("--branches must be at least 1 when splitting by size")
+		}
+	case "commits":
+		if commitsPerBranch < 1 {
+			return fmt.Errorf("--commits-per-branch must be at least 1 when splitting by commits")
+		}
+		switch {
+		case configFile != "" || interactiveTUI || listOnly:
+			return fmt.Errorf("--split-by commits cannot be used with --config, --interactive-tui or --list")
+		case noCommit || stacked:
+			return fmt.Errorf("--split-by commits cannot be used with --no-commit or --stacked (its branches are always stacked)")
+		}
+		// The commit ranges are squashed as they are, without a diff file
+		// list or a checkout, so these flags would have no effect
+		for _, name := range []string{
+			"include-deletions", "include-deletes", "include-adds", "include-modifies", "include-renames",
+			"exclude", "include", "path", "since", "sort", "files-from", "allow-shared", "max-branches",
+			"detect-renames", "rename-detection", "rename-threshold", "split-hunks",
+			"lfs", "content-filter", "ignore-filter-errors", "eol", "manifest", "respect-gitignore", "on-residue",
+			"post-branch-hook", "ignore-hook-errors", "open-pr", "use-worktree", "preserve-index",
+			"resume", "restart", "progress",
+		} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s cannot be used with --split-by commits", name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown --split-by value '%s' (expected count, dir, ext, size or commits)", splitBy)
+	}
+	switch renameDetection {
+	case "":
+	case "off":
+		if detectRenames {
+			return fmt.Errorf("--rename-detection off cannot be used with --detect-renames")
+		}
+	case "exact", "similar":
+		detectRenames = true
+	default:
+		return fmt.Errorf("unknown --rename-detection value '%s' (expected off, exact or similar)", renameDetection)
+	}
+	if renameThreshold < 0 || renameThreshold > 100 {
+		return fmt.Errorf("--rename-threshold must be between 0 and 100, got %d", renameThreshold)
+	}
+	switch diffSort {
+	case "path", "mtime", "diff":
+	default:
+		return fmt.Errorf("unknown --sort value '%s' (expected path, mtime or diff)", diffSort)
+	}
+	prefixes, err := split.CleanPathPrefixes(pathPrefixes)
+	if err != nil {
+		return err
+	}
+	pathPrefixes = prefixes
+	filePerm = 0
+	if fileModeText != "" {
+		perm, err := strconv.ParseUint(fileModeText, 8, 32)
+		if err != nil || perm == 0 || perm > 0777 {
+			return fmt.Errorf("invalid --file-mode '%s' (expected octal permissions like 0644)", fileModeText)
+		}
+		if splitBy == "commits" {
+			return fmt.Errorf("--file-mode cannot be used with --split-by commits")
+		}
+		filePerm = os.FileMode(perm)
+	}
+	if keepTests {
+		if err := split.ValidateTestPatterns(testPatterns); err != nil {
+			return err
+		}
+	}
+	if commitTmplFile != "" && !cmd.Flags().Changed("commit-msg-mode") {
+		commitMsgMode = "template"
+	}
+	switch commitMsgMode {
+	case "files", "latest", "first-line":
+	case "template":
+		if commitTmplFile == "" {
+			return fmt.Errorf("--commit-msg-mode template requires --commit-template")
+		}
+	default:
+		return fmt.Errorf("unknown --commit-msg-mode value '%s' (expected files, latest, first-line or template)", commitMsgMode)
+	}
+	for _, pattern := range append(append(append([]string{}, excludePatterns...), includePatterns...), sharedPatterns...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern '%s': %v", pattern, err)
+		}
+	}
+	switch eolMode {
+	case "", "lf", "crlf", "native":
+	default:
+		return fmt.Errorf("unknown --eol value '%s' (expected lf, crlf or native)", eolMode)
+	}
+	if manifestFile != "" {
+		manifestFile = filepath.ToSlash(filepath.Clean(manifestFile))
+		if filepath.IsAbs(manifestFile) || manifestFile == "." || strings.HasPrefix(manifestFile, "../") || manifestFile == ".." {
+			return fmt.Errorf("--manifest must be a path inside the repository, got '%s'", manifestFile)
+		}
+	}
+	if sinceText != "" {
+		since, err := split.ParseSince(sinceText, time.Now())
+		if err != nil {
+			return err
+		}
+		sinceTime = since
+	}
+	if authorText != "" {
+		author, err := split.ParseAuthor(authorText)
+		if err != nil {
+			return err
+		}
+		authorIdent = author
+	}
+	if date := dateText; date != "" || os.Getenv("GIT_AUTHOR_DATE") != "" {
+		source := "--date"
+		if date == "" {
+			date, source = os.Getenv("GIT_AUTHOR_DATE"), "GIT_AUTHOR_DATE"
+		}
+		when, err := split.ParseCommitDate(date)
+		if err != nil {
+			return fmt.Errorf("invalid %s value '%s': %v", source, date, err)
+		}
+		authorDate = when
+	}
+	if interactiveTUI {
+		switch {
+		case configFile != "" || assumeYes:
+			return fmt.Errorf("--interactive-tui cannot be used with --config or --yes")
+		case splitBy == "dir" || splitBy == "ext":
+			return fmt.Errorf("--interactive-tui cannot be used with --split-by %s", splitBy)
+		}
+	}
+	switch lfsMode {
+	case "pointer", "smudge", "skip":
+	default:
+		return fmt.Errorf("unknown --lfs value '%s' (expected pointer, smudge or skip)", lfsMode)
+	}
+	switch onResidue {
+	case "stash", "discard":
+	case "commit":
+		if noCommit {
+			return fmt.Errorf("--on-residue commit cannot be used with --no-commit")
+		}
+	default:
+		return fmt.Errorf("unknown --on-residue value '%s' (expected commit, discard or stash)", onResidue)
+	}
+	if noCommit && pushRemote != "" {
+		return fmt.Errorf("--no-commit cannot be used with --push")
+	}
+	if stackCumulative && !stacked {
+		return fmt.Errorf("--stacked-cumulative requires --stacked")
+	}
+	if stacked && noCommit {
+		return fmt.Errorf("--stacked cannot be used with --no-commit")
+	}
+	if ignoreHookErrors && postBranchHook == "" {
+		return fmt.Errorf("--ignore-hook-errors requires --post-branch-hook")
+	}
+	if maxBranches < 0 {
+		return fmt.Errorf("--max-branches must not be negative, got %d", maxBranches)
+	}
+	switch overflowMode {
+	case "pack", "drop", "keep":
+	default:
+		return fmt.Errorf("unknown --overflow value '%s' (expected pack, drop or keep)", overflowMode)
+	}
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1, got %d", jobs)
+	}
+	if verbose && quiet {
+		return fmt.Errorf("--verbose and --quiet cannot be used together")
+	}
+	if nameMapFile != "" && splitBy != "dir" {
+		return fmt.Errorf("--name-map can only be used with --split-by dir")
+	}
+	if asTags && alsoTag {
+		return fmt.Errorf("--as-tags and --also-tag cannot be used together")
+	}
+	if branchOptions().TagSplits() && noCommit {
+		return fmt.Errorf("--as-tags and --also-tag cannot be used with --no-commit")
+	}
+	if asTags && openPR {
+		return fmt.Errorf("--as-tags cannot be used with --open-pr, which needs the branches")
+	}
+	if commitMsgText != "" && commitMsgFile != "" {
+		return fmt.Errorf("--message and --message-file cannot be used together")
+	}
+	if resumeSplit && restartSplit {
+		return fmt.Errorf("--resume and --restart cannot be used together")
+	}
+	if forceBranches && suffixTimestamp {
+		return fmt.Errorf("--force and --suffix-timestamp cannot be used together")
+	}
+	if err := validateConfigFormat(); err != nil {
+		return err
+	}
+	if outputFormat != "text" && outputFormat != "json" {
+		return fmt.Errorf("unknown --output value '%s' (expected text or json)", outputFormat)
+	}
+	return nil
+}
+
 func openRepository() (*git.Repository, error) {
-	repo, err := git.PlainOpen(".")
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err == git.ErrRepositoryNotExists {
+		// A bare repository has no .git directory to detect
+		repo, err = git.PlainOpen(".")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open repository: %v", err)
 	}
-	fmt.Println("Repository opened successfully")
+	if err := enterWorktreeRoot(repo); err != nil {
+		return nil, err
+	}
+	verbosef("Repository opened successfully\n")
 	return repo, nil
 }
 
+// applyGitConfigDefaults takes the defaults of --base and --prefix from the
+// split.base and split.prefix settings of git config, so that a repository
+// can set its conventions once. Flags given on the command line still win.
+func applyGitConfigDefaults() {
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		// run reports this when it opens the repository
+		return
+	}
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return
+	}
+	section := cfg.Raw.Section("split")
+	if base := section.Option("base"); base != "" {
+		setFlagDefault(rootCmd, "base", base)
+		setFlagDefault(diffCmd, "base", base)
+		setFlagDefault(mergeCmd, "base", base)
+		baseFromConfig = true
+	}
+	if prefix := section.Option("prefix"); prefix != "" {
+		setFlagDefault(rootCmd, "prefix", prefix)
+		setFlagDefault(cleanCmd, "prefix", prefix)
+		setFlagDefault(mergeCmd, "prefix", prefix)
+	}
+}
+
+func setFlagDefault(cmd *cobra.Command, name, value string) {
+	flag := cmd.Flags().Lookup(name)
+	flag.Value.Set(value)
+	flag.DefValue = value
+}
+
 func displayBranches(repo *git.Repository) {
 	refs, _ := repo.References()
-	fmt.Println("\nAvailable branches:")
+	infof("\nAvailable branches:\n")
 	_ = refs.ForEach(func(ref *plumbing.Reference) error {
 		if ref.Name().IsBranch() {
-			fmt.Printf("- %s\n", ref.Name().Short())
+			infof("- %s\n", ref.Name().Short())
 		}
 		return nil
 	})
 }
 
-func getBranchCommitAndTree(repo *git.Repository, branchName string) (*object.Commit, *object.Tree, error) {
-	fmt.Printf("Getting reference for branch '%s'...\n", branchName)
-	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branchName), true)
-	if err != nil {
+// getBranchCommitAndTree returns the commit and tree of revision; the
+// available branches are listed when it cannot be resolved.
+func getBranchCommitAndTree(repo *git.Repository, revision string) (*object.Commit, *object.Tree, error) {
+	commit, tree, err := split.CommitAndTree(repo, revision)
+	if err != nil && errors.Is(err, ErrBranchNotFound) {
 		displayBranches(repo)
-		return nil, nil, fmt.Errorf("failed to get reference for branch '%s': %v", branchName, err)
 	}
-	fmt.Printf("Successfully got reference for branch '%s'\n", branchName)
-	commit, err := repo.CommitObject(ref.Hash())
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get commit for branch '%s': %v", branchName, err)
+	return commit, tree, err
+}
+
+// printDiffList prints the diff files for --list, as a JSON array on stdout
+// with --output json.
+func printDiffList(diff []DiffFile) error {
+	if outputFormat == "json" {
+		if diff == nil {
+			diff = []DiffFile{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
 	}
-	tree, err := commit.Tree()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get tree for branch '%s': %v", branchName, err)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, file := range diff {
+		if file.Action == split.ActionRename {
+			fmt.Fprintf(w, "%s\t%s -> %s\n", file.Action, file.From, file.Name)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", file.Action, file.Name)
+		}
 	}
-	return commit, tree, nil
+	return w.Flush()
 }
 
-func getDiffFiles(baseTree, sourceTree *object.Tree) ([]string, error) {
-	changes, err := baseTree.Diff(sourceTree)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get diff: %v", err)
+// splitOptions returns the flags that decide how the split config is
+// generated.
+func splitOptions() split.Options {
+	return split.Options{
+		SplitBy:        splitBy,
+		FilesPerBranch: filesPerBranch,
+		NumBranches:    numBranches,
+		DirDepth:       dirDepth,
+		GroupByPackage: groupByPackage,
+		BranchName:     branchName,
+
+		KeepTestsTogether: keepTests,
+		TestPatterns:      testPatterns,
 	}
+}
 
-	fileSet := make(map[string]bool)
-	var diffFiles []string
-	for _, change := range changes {
-		action, err := change.Action()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get action for change: %v", err)
+// diffOptions returns the flags that decide which diff files are split.
+func diffOptions() split.DiffOptions {
+	return split.DiffOptions{
+		DetectRenames:   detectRenames,
+		RenameThreshold: renameThreshold,
+		ExactRenames:    renameDetection == "exact",
+
+		IncludeAdds:      includeAdds,
+		IncludeModifies:  includeModifies,
+		IncludeDeletions: includeDeletions,
+		IncludeRenames:   includeRenames,
+		CountLines:       splitBy == "size",
+
+		PathPrefixes: pathPrefixes,
+		Include:      includePatterns,
+		Exclude:      excludePatterns,
+		Sort:         diffSort,
+		Logs:         commitLogs,
+	}
+}
+
+// messageOptions returns the flags that decide the commit messages.
+func messageOptions() split.MessageOptions {
+	return split.MessageOptions{
+		Mode:     commitMsgMode,
+		Template: commitTmpl,
+		Fixed:    fixedMsgTmpl,
+		Logs:     commitLogs,
+	}
+}
+
+// branchOptions returns the flags that decide how the branches are created.
+func branchOptions() split.BranchOptions {
+	return split.BranchOptions{
+		Range:    split.Range{Base: baseBranch, Source: sourceBranch},
+		Messages: messageOptions(),
+		Hunks:    splitFileHunks,
+
+		IncludeDeletions: includeDeletions,
+		Stacked:          stacked,
+		StackCumulative:  stackCumulative,
+
+		FilePerm:           filePerm,
+		LFS:                lfsMode,
+		ContentFilter:      contentFilter,
+		IgnoreFilterErrors: ignoreFilterErrs,
+		EOL:                eolMode,
+		Manifest:           manifestFile,
+		RespectIgnore:      respectIgnore,
+		NoCommit:           noCommit,
+		OnResidue:          onResidue,
+
+		AddTrailers: addTrailers,
+		Author:      authorIdent,
+		AuthorDate:  authorDate,
+		Sign:        signCommits,
+		SignKey:     signKey,
+		Stats:       showStats,
+		AsTags:      asTags,
+		AlsoTag:     alsoTag,
+
+		PostBranchHook:   postBranchHook,
+		IgnoreHookErrors: ignoreHookErrors,
+		Push:             pushRemote,
+		Token:            pushToken,
+
+		RollbackOnError: rollbackOnError,
+		Resume:          resumeSplit,
+		Restart:         restartSplit,
+		UseWorktree:     useWorktree,
+		PreserveIndex:   preserveIndex,
+		Force:           forceBranches,
+		SuffixTimestamp: suffixTimestamp,
+		Jobs:            jobs,
+		Progress:        showProgress,
+	}
+}
+
+func createSplitConfig(diff []DiffFile, sourceTree *object.Tree) (SplitConfig, error) {
+	cfg, err := split.Generate(diff, sourceTree, splitOptions())
+	if err != nil {
+		return cfg, err
+	}
+	infof("Number of branches to be created: %d\n", len(cfg.Branches))
+	if splitBy == "size" {
+		lines := make(map[string]int, len(diff))
+		for _, file := range diff {
+			lines[file.Name] = split.SizeLines(file)
 		}
-		if action == merkletrie.Delete {
-			continue
+		for _, group := range cfg.Branches {
+			total := 0
+			for _, file := range group.Files {
+				total += lines[file]
+			}
+			verbosef("Branch '%s': %d file(s), %d changed line(s)\n", group.Name, len(group.Files), total)
 		}
-		var fileName string
-		if change.To.Name != "" {
-			fileName = change.To.Name
-		} else if change.From.Name != "" {
-			fileName = change.From.Name
+	}
+
+	if maxBranches > 0 && len(cfg.Branches) > maxBranches {
+		overflow := 0
+		for _, group := range cfg.Branches[maxBranches:] {
+			overflow += len(group.Files)
 		}
-		if fileName != "" && !fileSet[fileName] {
-			diffFiles = append(diffFiles, fileName)
-			fileSet[fileName] = true
+		infof("Warning: capping the %d generated branch groups at --max-branches %d; %d file(s) beyond the limit are handled with --overflow %s\n", len(cfg.Branches), maxBranches, overflow, overflowMode)
+		cfg = split.CapBranchGroups(cfg, maxBranches, overflowMode)
+	}
+	// e.g. a --name-template without {{.Index}}, {{.Dir}} or {{.Ext}}
+	if problems := split.BranchNameConflicts(cfg); len(problems) > 0 {
+		return cfg, split.ConfigError(fmt.Errorf("the generated branch names conflict (make --name-template or --name-map give each group its own name):\n  %s", strings.Join(problems, "\n  ")))
+	}
+	return cfg, nil
+}
+
+// Variables available to --name-template
+type nameTemplateData struct {
+	Index  int
+	Prefix string
+	Dir    string
+	Ext    string
+}
+
+// branchName returns the name of the index-th generated branch (1-based).
+// key is the grouping directory with --split-by dir and the extension with
+// --split-by ext, or empty when it does not apply.
+func branchName(index int, key string) (string, error) {
+	data := nameTemplateData{Index: index, Prefix: branchPrefix}
+	switch splitBy {
+	case "dir":
+		if name, ok := mappedBranchName(key); ok {
+			return name, nil
+		}
+		data.Dir = key
+	case "ext":
+		data.Ext = key
+	}
+	if nameTmpl == nil {
+		var name string
+		switch {
+		case splitBy == "ext":
+			name = fmt.Sprintf("%s_%s", branchPrefix, key)
+		case splitBy != "dir":
+			name = fmt.Sprintf("%s_%d", branchPrefix, index)
+		case data.Dir == "":
+			name = branchPrefix
+		default:
+			name = fmt.Sprintf("%s_%s", branchPrefix, strings.ReplaceAll(data.Dir, "/", "-"))
 		}
+		return sanitizedName(name), nil
 	}
 
-	fmt.Printf("Diff files count: %d\n", len(diffFiles))
-	return diffFiles, nil
+	var buf strings.Builder
+	if err := nameTmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render name template: %v", err)
+	}
+	name := sanitizedName(buf.String())
+	if err := split.ValidateBranchName(name); err != nil {
+		return "", fmt.Errorf("name template produced an invalid branch name: %v", err)
+	}
+	return name, nil
 }
 
-func createSplitConfig(diffFiles []string) SplitConfig {
-	totalFiles := len(diffFiles)
-	numBranches := (totalFiles + filesPerBranch - 1) / filesPerBranch
-	fmt.Printf("Number of branches to be created: %d\n", numBranches)
+// sanitizedName returns name cleaned up by split.SanitizeBranchName with
+// --sanitize-names, reporting the change, and name itself otherwise.
+func sanitizedName(name string) string {
+	if !sanitizeNames {
+		return name
+	}
+	clean := split.SanitizeBranchName(name)
+	if clean != name {
+		infof("Sanitized branch name '%s' to '%s'\n", name, clean)
+	}
+	return clean
+}
 
-	var cfg SplitConfig
-	for i := 0; i < numBranches; i++ {
-		start := i * filesPerBranch
-		end := start + filesPerBranch
-		if end > totalFiles {
-			end = totalFiles
-		}
-		group := BranchGroup{
-			Name:  fmt.Sprintf("%s_%d", branchPrefix, i+1),
-			Files: diffFiles[start:end],
+func marshalSplitConfig(cfg SplitConfig, format string) ([]byte, error) {
+	data, err := encodeSplitConfig(cfg, format)
+	if err != nil {
+		return nil, err
+	}
+	// JSON has no comments, so it goes without the description
+	if format == "json" {
+		return data, nil
+	}
+	description := "# This file contains the configuration for splitting branches.\n" +
+		"# Each branch group specifies a branch name and the list of files to be included in that branch.\n" +
+		"# An optional 'defaults' block can set commit_msg_mode, commit_template, push, stacked and sign for this run.\n\n"
+	return append([]byte(description), data...), nil
+}
+
+// addMessagePreviews puts the commit message each branch group would get
+// right now as a comment above the group, so that it can be checked while
+// editing. The comments are dropped when the config is read back.
+func addMessagePreviews(data []byte, cfg SplitConfig, format string) []byte {
+	start := "- name:"
+	if format == "toml" {
+		start = "[[branches]]"
+	} else if format == "json" {
+		return data
+	}
+	var out strings.Builder
+	group := 0
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if strings.HasPrefix(line, start) && group < len(cfg.Branches) {
+			if cfg.Branches[group].Name != split.KeepGroupName {
+				msg, err := split.CommitMessage(cfg.Branches[group], messageOptions())
+				if err != nil {
+					msg = fmt.Sprintf("(unavailable: %v)", err)
+				}
+				out.WriteString("# Commit message:\n")
+				for _, msgLine := range strings.Split(msg, "\n") {
+					out.WriteString(strings.TrimRight("#   "+msgLine, " ") + "\n")
+				}
+			}
+			group++
 		}
-		cfg.Branches = append(cfg.Branches, group)
+		out.WriteString(line)
 	}
-	return cfg
+	return []byte(out.String())
 }
 
 func createTempYAMLFile(cfg SplitConfig) (string, error) {
-	description := "# This YAML file contains the configuration for splitting branches.\n" +
-		"# Each branch group specifies a branch name and the list of files to be included in that branch.\n\n"
-
-	yamlData, err := yaml.Marshal(&cfg)
+	format := configFormatFor(configOut)
+	yamlData, err := marshalSplitConfig(cfg, format)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal YAML: %v", err)
+		return "", err
+	}
+	yamlData = addMessagePreviews(yamlData, cfg, format)
+	if configOut != "" {
+		if err := os.WriteFile(configOut, yamlData, 0644); err != nil {
+			return "", fmt.Errorf("failed to write split config to '%s': %v", configOut, err)
+		}
+		return configOut, nil
 	}
 
-	yamlData = append([]byte(description), yamlData...)
-	tmpFile, err := os.CreateTemp("", "split-config-*.yaml")
+	tmpFile, err := os.CreateTemp("", "split-config-*."+format)
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary file: %v", err)
 	}
@@ -215,127 +1415,296 @@ func createTempYAMLFile(cfg SplitConfig) (string, error) {
 	return tmpFileName, nil
 }
 
+// resolveEditor picks the editor command from --editor, then $EDITOR, and
+// only falls back to vi when stdin is a terminal it can run in.
+func resolveEditor(input *os.File) (string, error) {
+	if editorCmd != "" {
+		return editorCmd, nil
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor, nil
+	}
+	if !term.IsTerminal(int(input.Fd())) {
+		return "", fmt.Errorf("no editor configured and stdin is not a terminal; set $EDITOR, pass --editor, or use --yes or --config")
+	}
+	return "vi", nil
+}
+
 func editYAMLFile(tmpFileName string) error {
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "vi"
+	input, err := terminalInput()
+	if err != nil {
+		return err
+	}
+	if input != os.Stdin {
+		defer input.Close()
+	}
+	editor, err := resolveEditor(input)
+	if err != nil {
+		return err
 	}
 
-	editorParts := strings.Fields(editor)
-	var editCmd *exec.Cmd
-	if len(editorParts) > 1 {
-		editCmd = exec.Command(editorParts[0], append(editorParts[1:], tmpFileName)...)
-	} else {
-		editCmd = exec.Command(editor, tmpFileName)
+	reader := bufio.NewReader(input)
+	err = runEditor(editor, tmpFileName, input)
+	var execErr *exec.Error
+	if errors.As(err, &execErr) && errors.Is(execErr.Err, exec.ErrNotFound) {
+		fmt.Fprintf(split.LogOut, "Editor '%s' was not found. Set $EDITOR or pass --editor to use another editor.\n", editor)
+		editor, err = promptLine(reader, "Editor command to use (empty to abort): ")
+		if err != nil {
+			return err
+		}
+		if editor == "" {
+			return fmt.Errorf("aborted: no usable editor")
+		}
+		err = runEditor(editor, tmpFileName, input)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		answer, promptErr := promptLine(reader, fmt.Sprintf("Editor '%s' exited with status %d. Proceed with the config as it is? [y/N]: ", editor, exitErr.ExitCode()))
+		if promptErr != nil {
+			return err
+		}
+		if answer == "y" || answer == "yes" {
+			return nil
+		}
+		return fmt.Errorf("aborted: editor exited with status %d", exitErr.ExitCode())
 	}
-	editCmd.Stdin = os.Stdin
+	return err
+}
+
+func runEditor(editor, tmpFileName string, input *os.File) error {
+	editorParts, err := splitCommand(editor)
+	if err != nil {
+		return fmt.Errorf("invalid editor command '%s': %v", editor, err)
+	}
+	editCmd := exec.Command(editorParts[0], append(editorParts[1:], tmpFileName)...)
+	editCmd.Stdin = input
 	editCmd.Stdout = os.Stdout
 	editCmd.Stderr = os.Stderr
 	return editCmd.Run()
 }
 
-func readEditedYAMLFile(tmpFileName string) (SplitConfig, error) {
+// splitCommand splits a command line into its arguments the way a shell would
+// for plain words: arguments are separated by whitespace, and single or double
+// quotes keep spaces in them, e.g. "C:\Program Files\editor.exe" --wait.
+// A backslash escapes a following space, quote or backslash and is kept
+// otherwise, so Windows paths need no doubled backslashes.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && quote != '\'' && i+1 < len(runes) && strings.ContainsRune(" \t\"'\\", runes[i+1]):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the command is empty")
+	}
+	return args, nil
+}
+
+// promptLine asks a question on stderr and returns the trimmed answer.
+func promptLine(reader *bufio.Reader, question string) (string, error) {
+	fmt.Fprint(split.LogOut, question)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", fmt.Errorf("failed to read the answer: %v", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// Marker for the parse error comments injected at the top of the temporary file
+const yamlErrorPrefix = "# ERROR: "
+
+var errEmptyConfig = errors.New("aborted: the edited YAML file is empty")
+
+type configParseError struct {
+	err error
+}
+
+func (e *configParseError) Error() string {
+	return fmt.Sprintf("failed to parse edited config: %v", e.err)
+}
+
+func editConfigUntilValid(tmpFileName string, diffFiles []string) (SplitConfig, error) {
+	for {
+		if err := editYAMLFile(tmpFileName); err != nil {
+			return SplitConfig{}, fmt.Errorf("failed to edit YAML file: %v", err)
+		}
+
+		cfg, err := readEditedYAMLFile(tmpFileName, diffFiles)
+		var parseErr *configParseError
+		if !errors.As(err, &parseErr) {
+			return cfg, err
+		}
+		infof("Invalid config: %v\nReopening the editor. Empty the file to abort.\n", parseErr.err)
+		// JSON can't carry the error as a comment
+		if configFormatFor(tmpFileName) == "json" {
+			continue
+		}
+		if err := annotateYAMLFile(tmpFileName, parseErr.err); err != nil {
+			return SplitConfig{}, err
+		}
+	}
+}
+
+func annotateYAMLFile(tmpFileName string, parseErr error) error {
+	data, err := os.ReadFile(tmpFileName)
+	if err != nil {
+		return fmt.Errorf("failed to read the edited temporary file: %v", err)
+	}
+
+	// Drop the comments left by a previous attempt so errors don't pile up
+	lines := strings.Split(string(data), "\n")
+	for len(lines) > 0 && strings.HasPrefix(lines[0], yamlErrorPrefix) {
+		lines = lines[1:]
+	}
+
+	var header strings.Builder
+	for _, line := range strings.Split(parseErr.Error(), "\n") {
+		header.WriteString(yamlErrorPrefix + line + "\n")
+	}
+	annotated := header.String() + strings.Join(lines, "\n")
+	if err := os.WriteFile(tmpFileName, []byte(annotated), 0644); err != nil {
+		return fmt.Errorf("failed to write to temporary file: %v", err)
+	}
+	return nil
+}
+
+func readEditedYAMLFile(tmpFileName string, diffFiles []string) (SplitConfig, error) {
 	editedData, err := os.ReadFile(tmpFileName)
 	if err != nil {
 		return SplitConfig{}, fmt.Errorf("failed to read the edited temporary file: %v", err)
 	}
-	os.Remove(tmpFileName)
+	if isEmptyYAML(editedData) {
+		removeConfigFile(tmpFileName)
+		return SplitConfig{}, errEmptyConfig
+	}
 
 	var editedConfig SplitConfig
-	if err := yaml.Unmarshal(editedData, &editedConfig); err != nil {
-		return SplitConfig{}, fmt.Errorf("failed to parse edited YAML: %v", err)
+	if err := decodeSplitConfig(editedData, configFormatFor(tmpFileName), &editedConfig); err != nil {
+		return SplitConfig{}, &configParseError{err: err}
 	}
+	editedConfig = resolveConfigPaths(editedConfig, diffFiles)
+	if editedConfig, err = split.ExpandFilePatterns(editedConfig, diffFiles); err != nil {
+		return SplitConfig{}, &configParseError{err: err}
+	}
+	removeConfigFile(tmpFileName)
 	return editedConfig, nil
 }
 
-func createBranches(repo *git.Repository, baseCommit *object.Commit, sourceTree *object.Tree, cfg SplitConfig) error {
-	headRef, err := repo.Head()
-	if err != nil {
-		return fmt.Errorf("failed to get HEAD: %v", err)
-	}
-	currentBranch := headRef.Name().Short()
-	worktree, err := repo.Worktree()
-	if err != nil {
-		return fmt.Errorf("failed to get worktree: %v", err)
+// removeConfigFile deletes the edited split config unless --keep-config or
+// --config-out asked to retain it.
+func removeConfigFile(name string) {
+	if keepConfig || configOut != "" {
+		infof("Kept split config at '%s'\n", name)
+		return
 	}
+	os.Remove(name)
+}
 
-	for _, group := range cfg.Branches {
-		if len(group.Files) == 0 {
-			fmt.Printf("Skipping branch '%s' as there are no target files.\n", group.Name)
-			continue
-		}
-		fmt.Printf("==> Creating branch '%s' (number of target files: %d)\n", group.Name, len(group.Files))
-
-		if err := worktree.Checkout(&git.CheckoutOptions{
-			Branch: plumbing.NewBranchReferenceName(baseBranch),
-		}); err != nil {
-			return fmt.Errorf("failed to checkout to BASE branch: %v", err)
-		}
-		if err := worktree.Checkout(&git.CheckoutOptions{
-			Branch: plumbing.NewBranchReferenceName(group.Name),
-			Create: true,
-			Hash:   baseCommit.Hash,
-		}); err != nil {
-			return fmt.Errorf("failed to create new branch '%s': %v", group.Name, err)
+// isEmptyYAML reports whether data contains nothing but blank lines and comments.
+func isEmptyYAML(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
 		}
+	}
+	return true
+}
 
-		for _, file := range group.Files {
-			if _, err := sourceTree.File(file); err != nil {
-				fmt.Printf("Warning: '%s' does not exist in SOURCE branch.\n", file)
-				continue
-			}
-			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
-				return fmt.Errorf("failed to create directory '%s': %v", filepath.Dir(file), err)
-			}
-
-			fileContent, err := sourceTree.File(file)
-			if err != nil {
-				return fmt.Errorf("failed to get file '%s' from source tree: %v", file, err)
-			}
-
-			fileReader, err := fileContent.Reader()
-			if err != nil {
-				return fmt.Errorf("failed to get reader for file '%s': %v", file, err)
-			}
-			defer fileReader.Close()
+func loadConfigFile(path string, diffFiles []string) (SplitConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SplitConfig{}, fmt.Errorf("failed to read config file '%s': %v", path, err)
+	}
 
-			fileData, err := io.ReadAll(fileReader)
-			if err != nil {
-				return fmt.Errorf("failed to read file '%s': %v", file, err)
-			}
+	var cfg SplitConfig
+	if err := decodeSplitConfig(data, configFormatFor(path), &cfg); err != nil {
+		return SplitConfig{}, fmt.Errorf("failed to parse config file '%s': %v", path, err)
+	}
+	cfg = resolveConfigPaths(cfg, diffFiles)
+	if cfg, err = split.ExpandFilePatterns(cfg, diffFiles); err != nil {
+		return SplitConfig{}, fmt.Errorf("invalid config file '%s': %v", path, err)
+	}
+	infof("Loaded split config from '%s'\n", path)
+	return cfg, nil
+}
 
-			if err := os.WriteFile(file, fileData, 0644); err != nil {
-				return fmt.Errorf("failed to write file '%s': %v", file, err)
-			}
-			if _, err := worktree.Add(file); err != nil {
-				return fmt.Errorf("failed to add file '%s' to staging: %v", file, err)
-			}
-			fmt.Printf("Updated: %s\n", file)
+// applyConfigDefaults applies the defaults block of the split config to the
+// settings whose flags were not given on the command line, then validates the
+// resulting settings again.
+func applyConfigDefaults(cmd *cobra.Command, repo *git.Repository, defaults *ConfigDefaults) error {
+	if defaults == nil {
+		return nil
+	}
+	flags := cmd.Flags()
+	if defaults.CommitMsgMode != "" && !flags.Changed("commit-msg-mode") {
+		commitMsgMode = defaults.CommitMsgMode
+	}
+	if defaults.CommitTemplate != "" && !flags.Changed("commit-template") {
+		commitTmplFile = defaults.CommitTemplate
+		if defaults.CommitMsgMode == "" && !flags.Changed("commit-msg-mode") {
+			commitMsgMode = "template"
 		}
+	}
+	if defaults.Push != "" && !flags.Changed("push") {
+		pushRemote = defaults.Push
+	}
+	if defaults.Stacked != nil && !flags.Changed("stacked") {
+		stacked = *defaults.Stacked
+	}
+	if defaults.Sign != nil && !flags.Changed("sign") {
+		signCommits = *defaults.Sign
+	}
 
-		status, err := worktree.Status()
+	if err := validateSplitFlags(cmd); err != nil {
+		return err
+	}
+	if commitMsgMode == "template" {
+		tmpl, err := split.LoadCommitTemplate(commitTmplFile)
 		if err != nil {
-			return fmt.Errorf("failed to get worktree status: %v", err)
-		}
-		if status.IsClean() {
-			fmt.Printf("No changes to commit in branch '%s'. Skipping commit.\n", group.Name)
-		} else {
-			commitMsg := fmt.Sprintf("Update diff files: %v", group.Files)
-			cmd := exec.Command("git", "commit", "-m", commitMsg)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("failed to commit in branch '%s': %v", group.Name, err)
-			}
-			fmt.Printf("Committed to branch '%s'\n", group.Name)
+			return fmt.Errorf("failed to load commit template: %v", err)
 		}
+		commitTmpl = tmpl
 	}
-
-	if err := worktree.Checkout(&git.CheckoutOptions{
-		Branch: plumbing.NewBranchReferenceName(currentBranch),
-	}); err != nil {
-		return fmt.Errorf("failed to checkout back to original branch '%s': %v", currentBranch, err)
+	if pushRemote != "" {
+		if _, err := repo.Remote(pushRemote); err != nil {
+			return fmt.Errorf("failed to find remote '%s': %v", pushRemote, err)
+		}
 	}
-	fmt.Printf("Completed. Returned to original branch '%s'.\n", currentBranch)
+	verbosef("Applied defaults from the split config\n")
 	return nil
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		// Substring of the error, when one is expected
+		err string
+	}{
+		{command: "vim", want: []string{"vim"}},
+		{command: "  code   --wait  ", want: []string{"code", "--wait"}},
+		{command: `"C:\Program Files\editor.exe" --wait`, want: []string{`C:\Program Files\editor.exe`, "--wait"}},
+		{command: `C:\tools\vim.exe -f`, want: []string{`C:\tools\vim.exe`, "-f"}},
+		{command: `'/opt/my editor/bin/edit' --new-window`, want: []string{"/opt/my editor/bin/edit", "--new-window"}},
+		{command: `'it\'s'`, err: "unterminated ' quote"},
+		{command: `'a "b" c'`, want: []string{`a "b" c`}},
+		{command: `"a 'b' c"`, want: []string{"a 'b' c"}},
+		{command: `/opt/my\ editor/edit -w`, want: []string{"/opt/my editor/edit", "-w"}},
+		{command: `edit \"quoted\" back\\slash`, want: []string{"edit", `"quoted"`, `back\slash`}},
+		{command: `"say \"hi\""`, want: []string{`say "hi"`}},
+		{command: `pre"fix and"post`, want: []string{"prefix andpost"}},
+		{command: `edit ""`, want: []string{"edit", ""}},
+		{command: `"C:\Program Files\editor.exe --wait`, err: `unterminated " quote`},
+		{command: `edit 'file`, err: "unterminated ' quote"},
+		{command: "", err: "the command is empty"},
+		{command: " \t ", err: "the command is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("splitCommand(%q) = %q, %v; want an error containing %q", tt.command, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitCommand(%q): %v", tt.command, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/m0a/git-split-branch/internal/split"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergePrefix string
+	mergeInto   string
+	mergeFrom   string
+	mergeDryRun bool
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Merge the split branches back together into a new integration branch",
+	Args:  cobra.NoArgs,
+	RunE:  runMerge,
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	repo, err := openRepository()
+	if err != nil {
+		return fmt.Errorf("Failed to initialize repository: %w", err)
+	}
+	if split.IsBareRepository(repo) {
+		return fmt.Errorf("Critical Error: bare repository not supported, as merging needs a working tree")
+	}
+	if !cmd.Flags().Changed("base") && !baseFromConfig {
+		if detected, ok := split.DetectDefaultBranch(repo); ok {
+			mergeFrom = detected
+			infof("Auto-detected base branch '%s' from origin/HEAD\n", mergeFrom)
+		}
+	}
+	baseCommit, _, err := getBranchCommitAndTree(repo, mergeFrom)
+	if err != nil {
+		return fmt.Errorf("Failed to get base branch details: %w", err)
+	}
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName(mergeInto), false); err == nil {
+		return fmt.Errorf("Branch '%s' already exists; delete it or choose another --into", mergeInto)
+	}
+
+	branches, current, err := splitBranches(repo, mergePrefix)
+	if err != nil {
+		return fmt.Errorf("Failed to list split branches: %w", err)
+	}
+	if current != "" {
+		branches = append(branches, current)
+	}
+	sortSplitBranches(branches, mergePrefix)
+	if len(branches) == 0 {
+		infof("No branches with the prefix '%s' to merge.\n", mergePrefix)
+		return nil
+	}
+
+	infof("Merging %d branch(es) with the prefix '%s' into new branch '%s' from '%s' (%s), in this order:\n", len(branches), mergePrefix, mergeInto, mergeFrom, split.ShortHash(baseCommit.Hash.String()))
+	for _, name := range branches {
+		infof("- %s\n", name)
+	}
+	if mergeDryRun {
+		infof("Dry run: no branch was created.\n")
+		return nil
+	}
+	if err := split.CheckCleanWorktree(repo); err != nil {
+		return fmt.Errorf("Pre-flight check failed: %w", err)
+	}
+	headRef, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("Failed to get HEAD: %w", err)
+	}
+
+	if _, err := runGit("checkout", "-q", "-b", mergeInto, baseCommit.Hash.String()); err != nil {
+		return fmt.Errorf("Failed to create branch '%s': %w", mergeInto, err)
+	}
+	conflicts, mergeErr := mergeSplitBranches(branches)
+	if _, err := runGit("checkout", "-q", split.HeadName(headRef)); err != nil {
+		infof("Warning: failed to return to %s: %v\n", split.DescribeHead(headRef), err)
+	}
+	printMergeSummary(branches, conflicts)
+	if mergeErr != nil {
+		return fmt.Errorf("Failed to merge branches: %w", mergeErr)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d of %d branch(es) conflicted and were not merged into '%s'; merge them by hand with git merge", len(conflicts), len(branches), mergeInto)
+	}
+	infof("Completed. Merged %d branch(es) into '%s'.\n", len(branches), mergeInto)
+	return nil
+}
+
+// mergeSplitBranches merges each branch into the checked-out integration
+// branch with a merge commit. go-git cannot merge, so this shells out to git
+// like stashStaged. A merge that conflicts is aborted and its conflicting
+// files are returned by branch, so that the remaining branches still get
+// merged.
+func mergeSplitBranches(branches []string) (map[string][]string, error) {
+	conflicts := make(map[string][]string)
+	for _, name := range branches {
+		_, err := runGit("merge", "--no-ff", "--no-edit", "-m", fmt.Sprintf("Merge branch '%s' into %s", name, mergeInto), name)
+		if err == nil {
+			verbosef("Merged '%s'\n", name)
+			continue
+		}
+		files, diffErr := runGit("diff", "--name-only", "--diff-filter=U")
+		if _, abortErr := runGit("merge", "--abort"); abortErr != nil {
+			return conflicts, fmt.Errorf("failed to abort the merge of '%s': %v", name, abortErr)
+		}
+		if diffErr != nil || files == "" {
+			// Not a conflict, e.g. a hook or a missing identity
+			return conflicts, fmt.Errorf("failed to merge '%s': %v", name, err)
+		}
+		conflicts[name] = strings.Split(files, "\n")
+		infof("Warning: merging '%s' conflicts in %s; skipping it.\n", name, strings.Join(conflicts[name], ", "))
+	}
+	return conflicts, nil
+}
+
+func printMergeSummary(branches []string, conflicts map[string][]string) {
+	fmt.Fprintln(resultOut, "\nSummary:")
+	w := tabwriter.NewWriter(resultOut, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BRANCH\tSTATUS")
+	for _, name := range branches {
+		if files, ok := conflicts[name]; ok {
+			fmt.Fprintf(w, "%s\tconflict (%s)\n", name, strings.Join(files, ", "))
+		} else {
+			fmt.Fprintf(w, "%s\tmerged\n", name)
+		}
+	}
+	w.Flush()
+}
+
+// sortSplitBranches orders the split branches of prefix the way they were
+// generated: the numbered ones by their number, so that split_10 comes after
+// split_9, and the others by name after them.
+func sortSplitBranches(branches []string, prefix string) {
+	number := func(name string) (int, bool) {
+		n, err := strconv.Atoi(strings.TrimPrefix(name, prefix+"_"))
+		return n, err == nil && strings.HasPrefix(name, prefix+"_")
+	}
+	sort.SliceStable(branches, func(i, j int) bool {
+		ni, iok := number(branches[i])
+		nj, jok := number(branches[j])
+		switch {
+		case iok && jok:
+			return ni < nj
+		case iok != jok:
+			return iok
+		}
+		return branches[i] < branches[j]
+	})
+}
+
+// runGit runs git with args and returns its trimmed output, or an error that
+// includes it.
+func runGit(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	trimmed := strings.TrimSpace(string(out))
+	if err != nil {
+		return trimmed, fmt.Errorf("git %s: %v: %s", args[0], err, trimmed)
+	}
+	return trimmed, nil
+}
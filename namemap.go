@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/m0a/git-split-branch/internal/split"
+	"gopkg.in/yaml.v2"
+)
+
+// Branch names by grouping directory, read from --name-map
+var nameMap map[string]string
+
+// loadNameMap reads the YAML (or JSON) mapping of --name-map from directories,
+// as grouped with --split-by dir and --dir-depth, to branch names. The
+// repository root is ".".
+func loadNameMap(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read name map '%s': %v", file, err)
+	}
+	var raw map[string]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse name map '%s': %v", file, err)
+	}
+	names := make(map[string]string, len(raw))
+	dirs := make(map[string]string, len(raw))
+	keys := make([]string, 0, len(raw))
+	for dir := range raw {
+		keys = append(keys, dir)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := raw[key]
+		dir := path.Clean(strings.TrimSuffix(key, "/"))
+		if err := split.ValidateBranchName(name); err != nil {
+			return nil, fmt.Errorf("invalid branch name for '%s' in name map '%s': %v", dir, file, err)
+		}
+		if other, ok := dirs[name]; ok {
+			return nil, fmt.Errorf("name map '%s' gives both '%s' and '%s' the branch name '%s'", file, other, dir, name)
+		}
+		names[dir], dirs[name] = name, dir
+	}
+	return names, nil
+}
+
+// mappedBranchName returns the branch name --name-map gives the grouping
+// directory dir, if any.
+func mappedBranchName(dir string) (string, bool) {
+	if dir == "" {
+		dir = "."
+	}
+	name, ok := nameMap[dir]
+	return name, ok
+}
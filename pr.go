@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// forgeRepo identifies the repository behind the push remote on GitHub or
+// GitLab.
+type forgeRepo struct {
+	kind string // "github" or "gitlab"
+	host string
+	path string // owner/repo, or the full project path on GitLab
+}
+
+// parseForgeRemote reads the host and repository path from an https, ssh or
+// scp-like (git@host:owner/repo.git) remote URL.
+func parseForgeRemote(remoteURL string) (forgeRepo, error) {
+	var host, repoPath string
+	if u, err := url.Parse(remoteURL); err == nil && u.Host != "" {
+		host, repoPath = u.Hostname(), u.Path
+	} else if at := strings.Index(remoteURL, "@"); at >= 0 && strings.Contains(remoteURL[at:], ":") {
+		host, repoPath, _ = strings.Cut(remoteURL[at+1:], ":")
+	} else {
+		return forgeRepo{}, fmt.Errorf("cannot read the host from remote URL '%s'", remoteURL)
+	}
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+
+	forge := forgeRepo{host: host, path: repoPath}
+	switch {
+	case strings.Contains(host, "github"):
+		forge.kind = "github"
+	case strings.Contains(host, "gitlab"):
+		forge.kind = "gitlab"
+	default:
+		return forgeRepo{}, fmt.Errorf("cannot tell whether '%s' is a GitHub or GitLab host", host)
+	}
+	if forge.kind == "github" && strings.Count(repoPath, "/") != 1 {
+		return forgeRepo{}, fmt.Errorf("unexpected GitHub repository path '%s'", repoPath)
+	}
+	return forge, nil
+}
+
+// prToken returns --token, falling back to the usual environment variable of
+// the forge.
+func prToken(kind string) string {
+	if pushToken != "" {
+		return pushToken
+	}
+	if kind == "gitlab" {
+		return os.Getenv("GITLAB_TOKEN")
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// pullRequestForge returns the forge of the push remote and the token to
+// create pull requests with, so that --open-pr can be checked before any
+// branch is pushed.
+func pullRequestForge(repo *git.Repository) (forgeRepo, string, error) {
+	remote, err := repo.Remote(pushRemote)
+	if err != nil {
+		return forgeRepo{}, "", fmt.Errorf("failed to find remote '%s': %v", pushRemote, err)
+	}
+	forge, err := parseForgeRemote(remote.Config().URLs[0])
+	if err != nil {
+		return forgeRepo{}, "", err
+	}
+	token := prToken(forge.kind)
+	if token == "" {
+		return forgeRepo{}, "", fmt.Errorf("--open-pr needs a token: pass --token or set GITHUB_TOKEN or GITLAB_TOKEN")
+	}
+	return forge, token, nil
+}
+
+// openPullRequests opens a pull request (merge request on GitLab) from every
+// pushed branch into the base branch. It records the URLs in results and
+// returns an error if any of them could not be created.
+func openPullRequests(repo *git.Repository, results []BranchResult) error {
+	forge, token, err := pullRequestForge(repo)
+	if err != nil {
+		return err
+	}
+	// A base detected from origin/HEAD is a remote-tracking name
+	target := strings.TrimPrefix(baseBranch, pushRemote+"/")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var failed, unpushed []string
+	for i, result := range results {
+		if !result.Pushed {
+			if !result.Skipped {
+				unpushed = append(unpushed, result.Name)
+			}
+			continue
+		}
+		body := "Files:\n"
+		for _, file := range result.Files {
+			body += "- `" + file + "`\n"
+		}
+		prURL, err := createPullRequest(client, forge, token, result.Name, target, body)
+		if err != nil {
+			infof("Warning: failed to open a pull request for '%s': %v\n", result.Name, err)
+			failed = append(failed, result.Name)
+			continue
+		}
+		results[i].PullRequest = prURL
+		infof("Opened pull request for '%s': %s\n", result.Name, prURL)
+	}
+	if len(unpushed) > 0 {
+		infof("Warning: no pull request was opened for the branch(es) that were not pushed: %s\n", strings.Join(unpushed, ", "))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to open %d pull request(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func createPullRequest(client *http.Client, forge forgeRepo, token, branch, target, body string) (string, error) {
+	var endpoint string
+	var payload map[string]string
+	header := http.Header{"Content-Type": {"application/json"}}
+	switch forge.kind {
+	case "github":
+		api := "https://api.github.com"
+		if forge.host != "github.com" {
+			api = "https://" + forge.host + "/api/v3"
+		}
+		endpoint = api + "/repos/" + forge.path + "/pulls"
+		payload = map[string]string{"title": branch, "head": branch, "base": target, "body": body}
+		header.Set("Accept", "application/vnd.github+json")
+		header.Set("Authorization", "Bearer "+token)
+	case "gitlab":
+		endpoint = "https://" + forge.host + "/api/v4/projects/" + url.PathEscape(forge.path) + "/merge_requests"
+		payload = map[string]string{"title": branch, "source_branch": branch, "target_branch": target, "description": body}
+		header.Set("PRIVATE-TOKEN", token)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var created struct {
+		HTMLURL string `json:"html_url"`
+		WebURL  string `json:"web_url"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", fmt.Errorf("failed to parse the response: %v", err)
+	}
+	if created.WebURL != "" {
+		return created.WebURL, nil
+	}
+	return created.HTMLURL, nil
+}
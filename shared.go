@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/m0a/git-split-branch/internal/split"
+)
+
+// markSharedFiles records in each result the files of --allow-shared that
+// were committed to more than one branch.
+func markSharedFiles(results []BranchResult) {
+	if len(sharedPatterns) == 0 {
+		return
+	}
+	count := make(map[string]int)
+	for _, result := range results {
+		for _, file := range result.Files {
+			count[file]++
+		}
+	}
+	for i, result := range results {
+		for _, file := range result.Files {
+			if count[file] > 1 && split.MatchAnyGlob(sharedPatterns, file) {
+				results[i].Shared = append(results[i].Shared, file)
+			}
+		}
+	}
+}
+
+// printSharedFiles lists the shared files below the summary with the
+// branches that got them.
+func printSharedFiles(results []BranchResult) {
+	branches := make(map[string][]string)
+	var order []string
+	for _, result := range results {
+		for _, file := range result.Shared {
+			if _, ok := branches[file]; !ok {
+				order = append(order, file)
+			}
+			branches[file] = append(branches[file], result.Name)
+		}
+	}
+	if len(order) == 0 {
+		return
+	}
+	fmt.Fprintln(resultOut, "\nShared files:")
+	for _, file := range order {
+		fmt.Fprintf(resultOut, "- %s (%s)\n", file, strings.Join(branches[file], ", "))
+	}
+}
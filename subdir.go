@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/m0a/git-split-branch/internal/split"
+)
+
+// Directory the tool was started in, relative to the worktree root, such as
+// "pkg/api"; empty when it was started at the root
+var cwdPrefix string
+
+// enterWorktreeRoot makes the worktree root of repo the working directory,
+// since every diff path is relative to it, and remembers the directory the
+// tool was started in for the paths typed in the split config. Paths given in
+// flags are made absolute first so that they keep naming the same files.
+func enterWorktreeRoot(repo *git.Repository) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		// Bare repositories fail later with a clearer error
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %v", err)
+	}
+	root := worktree.Filesystem.Root()
+	rel, err := filepath.Rel(evalSymlinks(root), evalSymlinks(cwd))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	for _, flagPath := range []*string{&configFile, &configOut, &reportFile, &commitTmplFile, &filesFrom} {
+		if *flagPath != "" && *flagPath != "-" && !filepath.IsAbs(*flagPath) {
+			*flagPath = filepath.Join(cwd, *flagPath)
+		}
+	}
+	if err := os.Chdir(root); err != nil {
+		return fmt.Errorf("failed to change to the repository root '%s': %v", root, err)
+	}
+	cwdPrefix = filepath.ToSlash(rel)
+	verbosef("Running in '%s': file paths in the split config that are not diff paths are taken relative to it\n", cwdPrefix)
+	return nil
+}
+
+func evalSymlinks(dir string) string {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		return resolved
+	}
+	return dir
+}
+
+// resolveConfigPaths rewrites the file entries of cfg that are neither diff
+// files nor patterns matching one as paths relative to cwdPrefix, when that
+// turns them into one. Each rewritten entry is printed.
+func resolveConfigPaths(cfg SplitConfig, diffFiles []string) SplitConfig {
+	if cwdPrefix == "" {
+		return cfg
+	}
+	isDiffFile := make(map[string]bool, len(diffFiles))
+	for _, file := range diffFiles {
+		isDiffFile[file] = true
+	}
+	resolves := func(entry string) bool {
+		if isDiffFile[entry] || !strings.ContainsAny(entry, "*?[") {
+			return isDiffFile[entry]
+		}
+		for _, file := range diffFiles {
+			if split.MatchGlob(entry, file) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, group := range cfg.Branches {
+		for j, entry := range group.Files {
+			if joined := path.Join(cwdPrefix, entry); !resolves(entry) && resolves(joined) {
+				infof("Resolved '%s' in branch '%s' to '%s'\n", entry, group.Name, joined)
+				cfg.Branches[i].Files[j] = joined
+			}
+		}
+		for file, numbers := range group.Hunks {
+			if joined := path.Join(cwdPrefix, file); !isDiffFile[file] && isDiffFile[joined] {
+				delete(group.Hunks, file)
+				group.Hunks[joined] = numbers
+			}
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/m0a/git-split-branch/internal/split"
+	"golang.org/x/term"
+)
+
+// Groups are chosen with the digit keys, so at most nine can be used
+const maxTUIGroups = 9
+
+// groupModel is the bubbletea model of --interactive-tui. groups[i] is the
+// group number (1-9) of files[i], or 0 while the file is unassigned.
+type groupModel struct {
+	files  []string
+	groups []int
+	cursor int
+	offset int
+	height int
+	// Set after Enter was pressed while files were still unassigned
+	confirming bool
+	done       bool
+	aborted    bool
+}
+
+func (m groupModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m groupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		key := msg.String()
+		if key != "enter" {
+			m.confirming = false
+		}
+		switch key {
+		case "ctrl+c", "q", "esc":
+			m.aborted = true
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.files)-1 {
+				m.cursor++
+			}
+		case "0", "backspace", "delete":
+			m.groups[m.cursor] = 0
+		case "enter":
+			if m.unassigned() > 0 && !m.confirming {
+				m.confirming = true
+				return m, nil
+			}
+			m.done = true
+			return m, tea.Quit
+		default:
+			if len(key) == 1 && key[0] >= '1' && key[0] <= '9' {
+				m.groups[m.cursor] = int(key[0] - '0')
+				if m.cursor < len(m.files)-1 {
+					m.cursor++
+				}
+			}
+		}
+	}
+
+	// Keep the cursor inside the visible part of the list
+	if rows := m.listRows(); rows > 0 {
+		if m.cursor < m.offset {
+			m.offset = m.cursor
+		} else if m.cursor >= m.offset+rows {
+			m.offset = m.cursor - rows + 1
+		}
+	}
+	return m, nil
+}
+
+// listRows returns how many files fit on the screen besides the header and
+// footer lines, or 0 before the terminal size is known.
+func (m groupModel) listRows() int {
+	if m.height == 0 {
+		return 0
+	}
+	if rows := m.height - 6; rows > 1 {
+		return rows
+	}
+	return 1
+}
+
+func (m groupModel) unassigned() int {
+	count := 0
+	for _, group := range m.groups {
+		if group == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (m groupModel) View() string {
+	if m.done || m.aborted {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Assign diff files to branch groups: 1-9 assign, 0 unassign, j/k move, enter confirm, q abort\n\n")
+
+	end := len(m.files)
+	if rows := m.listRows(); rows > 0 && m.offset+rows < end {
+		end = m.offset + rows
+	}
+	for i := m.offset; i < end; i++ {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		if m.groups[i] == 0 {
+			fmt.Fprintf(&b, "%s[ ] %s  (unassigned)\n", cursor, m.files[i])
+		} else {
+			fmt.Fprintf(&b, "%s[%d] %s\n", cursor, m.groups[i], m.files[i])
+		}
+	}
+
+	counts := make([]int, maxTUIGroups+1)
+	for _, group := range m.groups {
+		counts[group]++
+	}
+	var summary []string
+	for group := 1; group <= maxTUIGroups; group++ {
+		if counts[group] > 0 {
+			summary = append(summary, fmt.Sprintf("%d: %d file(s)", group, counts[group]))
+		}
+	}
+	fmt.Fprintf(&b, "\nGroups: %s\n", strings.Join(summary, ", "))
+	if counts[0] > 0 {
+		fmt.Fprintf(&b, "Unassigned: %d file(s)", counts[0])
+		if m.confirming {
+			b.WriteString(" - they will not be split; press enter again to confirm")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// selectGroupsTUI lets the user assign diffFiles to numbered groups in a
+// terminal UI instead of editing YAML. The groups of initial, if any, are
+// used as the starting assignment.
+func selectGroupsTUI(diffFiles []string, initial SplitConfig) (SplitConfig, error) {
+	input, err := terminalInput()
+	if err != nil {
+		return SplitConfig{}, err
+	}
+	if input != os.Stdin {
+		defer input.Close()
+	}
+	if !term.IsTerminal(int(input.Fd())) {
+		return SplitConfig{}, fmt.Errorf("--interactive-tui requires stdin to be a terminal")
+	}
+
+	m := groupModel{files: diffFiles, groups: make([]int, len(diffFiles))}
+	index := make(map[string]int)
+	for i, file := range diffFiles {
+		index[file] = i
+	}
+	g := 0
+	for _, group := range initial.Branches {
+		// Files kept out of the split start unassigned
+		if group.Name == split.KeepGroupName {
+			continue
+		}
+		if g >= maxTUIGroups {
+			break
+		}
+		for _, file := range group.Files {
+			if i, ok := index[file]; ok {
+				m.groups[i] = g + 1
+			}
+		}
+		g++
+	}
+
+	final, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithInput(input), tea.WithOutput(os.Stderr)).Run()
+	if err != nil {
+		return SplitConfig{}, fmt.Errorf("failed to run the interactive UI: %v", err)
+	}
+	m = final.(groupModel)
+	if m.aborted {
+		return SplitConfig{}, fmt.Errorf("aborted in the interactive UI")
+	}
+
+	var cfg SplitConfig
+	for group := 1; group <= maxTUIGroups; group++ {
+		var files []string
+		for i, file := range m.files {
+			if m.groups[i] == group {
+				files = append(files, file)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		name, err := branchName(group, "")
+		if err != nil {
+			return SplitConfig{}, err
+		}
+		cfg.Branches = append(cfg.Branches, BranchGroup{Name: name, Files: files})
+	}
+	return cfg, nil
+}